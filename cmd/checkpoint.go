@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+
+	"metron_code_jam/internal/checkpoint"
+	"metron_code_jam/pkg/metronet"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	checkpointFile string
+	resumeFile     string
+)
+
+// sessionFlags only affect how a run reports, not what it scans, so they are
+// neither saved in checkpoints nor restored from them
+var sessionFlags = map[string]bool{
+	"checkpoint":  true,
+	"resume":      true,
+	"output":      true,
+	"show-closed": true,
+	"no-progress": true,
+	"verbose":     true,
+	"quiet":       true,
+	"log-format":  true,
+	"log-file":    true,
+}
+
+// scanArgs returns the scan flags given on the command line, in a form that
+// can be parsed again
+func scanArgs(flags *pflag.FlagSet) []string {
+	var args []string
+	flags.Visit(func(f *pflag.Flag) {
+		if sessionFlags[f.Name] {
+			return
+		}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			for _, v := range sv.GetSlice() {
+				args = append(args, "--"+f.Name+"="+v)
+			}
+			return
+		}
+		args = append(args, "--"+f.Name+"="+f.Value.String())
+	})
+	return args
+}
+
+// restoreCheckpoint loads the --resume file, restores the flags the scan was
+// started with and returns the checkpoint, which holds the ports already scanned
+func restoreCheckpoint(cmd *cobra.Command) (*checkpoint.Checkpoint, error) {
+	var extra []string
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if !sessionFlags[f.Name] {
+			extra = append(extra, "--"+f.Name)
+		}
+	})
+	if len(extra) > 0 {
+		return nil, fmt.Errorf("--resume reuses the settings of the interrupted scan and cannot be combined with %v", extra)
+	}
+
+	cp, err := checkpoint.Load(resumeFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading checkpoint: %v", err)
+	}
+	if err := cmd.Flags().Parse(cp.Args); err != nil {
+		return nil, fmt.Errorf("error restoring checkpoint settings: %v", err)
+	}
+	return cp, nil
+}
+
+// openCheckpoint starts a new checkpoint file for --checkpoint, saving the
+// addresses targets resolved to, or continues the --resume file, resumed,
+// where it ends. It returns nil when neither was given.
+func openCheckpoint(cmd *cobra.Command, resumed *checkpoint.Checkpoint, targets *metronet.Targets) (*checkpoint.Writer, error) {
+	switch {
+	case resumed != nil:
+		return checkpoint.Append(resumeFile, resumed.Size)
+	case checkpointFile != "":
+		return checkpoint.Create(checkpointFile, scanArgs(cmd.Flags()), targets.Resolved())
+	}
+	return nil, nil
+}
+
+// savedPath returns the checkpoint file this run writes to
+func savedPath() string {
+	if resumeFile != "" {
+		return resumeFile
+	}
+	return checkpointFile
+}
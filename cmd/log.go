@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+var (
+	verbosity int
+	quiet     bool
+	logFormat string
+	logFile   string
+)
+
+// logger receives all diagnostics; stdout is kept for results
+var logger = slog.New(slog.DiscardHandler)
+
+// logOutput is the --log-file, closed when the command finishes
+var logOutput io.Closer
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.CountVarP(&verbosity, "verbose", "v", "Log progress (-v) or every port (-vv) to stderr")
+	flags.BoolVarP(&quiet, "quiet", "q", false, "Only log errors")
+	flags.StringVar(&logFormat, "log-format", "text", "Log format: text or json")
+	flags.StringVar(&logFile, "log-file", "", "Write logs to a file instead of stderr")
+	rootCmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
+}
+
+// setupLogging creates the logger selected by the logging flags. Warnings
+// are logged by default, -v adds progress and -vv every port scanned.
+func setupLogging() error {
+	level := slog.LevelWarn
+	switch {
+	case quiet:
+		level = slog.LevelError
+	case verbosity == 1:
+		level = slog.LevelInfo
+	case verbosity > 1:
+		level = slog.LevelDebug
+	}
+
+	var w io.Writer = os.Stderr
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("error opening log file: %v", err)
+		}
+		w, logOutput = f, f
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(logFormat) {
+	case "text":
+		logger = slog.New(slog.NewTextHandler(w, opts))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(w, opts))
+	default:
+		return fmt.Errorf("unknown log format %q (expected text or json)", logFormat)
+	}
+	slog.SetDefault(logger)
+	return nil
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"metron_code_jam/pkg/metronet"
+)
+
+// progressPrinter shows scan progress on stderr: rewritten in place on a
+// terminal, or as a new line for each update when stderr is redirected
+type progressPrinter struct {
+	w     io.Writer
+	tty   bool
+	shown bool // a line is on screen and must be cleared before other output
+}
+
+// pipeInterval is how often progress lines are written when stderr is not a
+// terminal, to keep logs short
+const pipeInterval = 10 * time.Second
+
+func newProgressPrinter() *progressPrinter {
+	fi, err := os.Stderr.Stat()
+	tty := err == nil && fi.Mode()&os.ModeCharDevice != 0
+	return &progressPrinter{w: os.Stderr, tty: tty}
+}
+
+// update shows the latest snapshot of the scan
+func (pp *progressPrinter) update(p metronet.Progress) {
+	if pp.tty {
+		fmt.Fprintf(pp.w, "\r\033[K%s", formatProgress(p))
+		pp.shown = true
+		return
+	}
+	fmt.Fprintf(pp.w, "progress: %s\n", formatProgress(p))
+}
+
+// clear removes the progress line so other output starts on a clean line
+func (pp *progressPrinter) clear() {
+	if pp.shown {
+		fmt.Fprint(pp.w, "\r\033[K")
+		pp.shown = false
+	}
+}
+
+// formatProgress renders a snapshot as a single line, e.g.
+// "[ 42.1%] 27612/65535 ports, 3 open, 1450 ports/s, ETA 26s"
+func formatProgress(p metronet.Progress) string {
+	var b strings.Builder
+	if p.PortsTotal > 0 {
+		fmt.Fprintf(&b, "[%5.1f%%] %d/%d ports", p.Percent(), p.PortsDone, p.PortsTotal)
+	} else {
+		fmt.Fprintf(&b, "%d ports", p.PortsDone)
+	}
+	fmt.Fprintf(&b, ", %d open, %.0f ports/s", p.OpenPorts, p.Rate)
+	if p.ETA > 0 {
+		fmt.Fprintf(&b, ", ETA %v", p.ETA)
+	}
+
+	// Name the hosts in progress when there are few enough to fit
+	if p.HostsTotal > 1 {
+		fmt.Fprintf(&b, ", hosts %d/%d", p.HostsDone, p.HostsTotal)
+	}
+	if len(p.Hosts) > 1 && len(p.Hosts) <= 3 {
+		for _, h := range p.Hosts {
+			fmt.Fprintf(&b, " | %s %d/%d", h.Target.IP, h.PortsDone, h.PortsTotal)
+		}
+	}
+	return b.String()
+}
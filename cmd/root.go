@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -11,15 +12,42 @@ var rootCmd = &cobra.Command{
 	Use:   "metronet",
 	Short: "MetroNet - Network Port Scanner",
 	Long:  `MetroNet is a high-performance network port scanner with service detection and banner grabbing capabilities.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return setupLogging()
+	},
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	rootCmd.SetArgs(nmapAliases(os.Args[1:]))
+	err := rootCmd.Execute()
+	if logOutput != nil {
+		logOutput.Close()
+	}
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
+// nmapAliases rewrites nmap-style multi-letter flags, which cannot be declared
+// as shorthands, into their long form
+func nmapAliases(args []string) []string {
+	out := make([]string, 0, len(args))
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			return append(out, args[i:]...)
+		case arg == "-iL":
+			out = append(out, "--input-list")
+		case strings.HasPrefix(arg, "-iL="):
+			out = append(out, "--input-list="+strings.TrimPrefix(arg, "-iL="))
+		default:
+			out = append(out, arg)
+		}
+	}
+	return out
+}
+
 func init() {
 	// Add any global flags here if needed
 }
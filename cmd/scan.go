@@ -1,16 +1,23 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"os"
+	"os/signal"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
-	"metron_code_jam/internal/network"
-	"metron_code_jam/internal/scanner"
+	"metron_code_jam/internal/checkpoint"
 	"metron_code_jam/internal/constants"
+	"metron_code_jam/internal/output"
+	"metron_code_jam/pkg/metronet"
 
 	"github.com/spf13/cobra"
 )
@@ -18,11 +25,41 @@ import (
 var (
 	host        string
 	ports       string
-	timeout     int
+	timeout     string
 	concurrency int
 	randomize   bool
 	delay       int
 	showClosed  bool
+	outputFmt   string
+	udp         bool
+	noBanner    bool
+	tlsDetect   bool
+	probeFiles  []string
+	intensity   int
+	redirects   int
+	inputList   string
+	excludeList string
+	excludeFile string
+	resolveAll  bool
+	interleave  bool
+	parallel    int
+	perHost     int
+	rate        float64
+	burst       int
+	fixedWait   bool
+	minTimeout  time.Duration
+	maxTimeout  time.Duration
+	retries     int
+	noProgress  bool
+	topPorts    int
+	excludePort string
+	onlyIPv4    bool
+	onlyIPv6    bool
+	dualStack   bool
+	proxies     []string
+	sourceIP    string
+	sourcePort  int
+	iface       string
 )
 
 var scanCmd = &cobra.Command{
@@ -42,123 +79,540 @@ Examples:
   
   # Scan a subnet
   metronet scan -h 192.168.1.0/24 -p 22,80
+
+  # Scan a list of targets, skipping the gateways
+  metronet scan -iL targets.txt --exclude 10.0.0.1,10.0.1-3.1 -p 22
   
   # Full port scan with high concurrency
-  metronet scan -h scanme.nmap.org --full -c 500`,
+  metronet scan -h scanme.nmap.org --full -c 500
+
+  # UDP scan of common services
+  metronet scan -H 192.168.1.1 -p 53,123,161 --udp
+
+  # Stream results as NDJSON for a pipeline
+  metronet scan -H 192.168.1.0/24 -p 22,80 -o ndjson`,
 	RunE: runScan,
 }
 
 func init() {
 	rootCmd.AddCommand(scanCmd)
 	// Define flags
-	scanCmd.Flags().StringVarP(&host, "host", "H", "", "Target host or subnet (required)")
-	scanCmd.Flags().StringVarP(&ports, "ports", "p", "", "Ports to scan (e.g., 22,80,443 or 1-1000)")
-	scanCmd.Flags().IntVarP(&timeout, "timeout", "t", constants.Timeout, "Connection timeout in seconds")
+	scanCmd.Flags().StringVarP(&host, "host", "H", "", "Targets: hosts, IPs, CIDR subnets or ranges like 10.0.0.1-40, comma-separated")
+	scanCmd.Flags().StringVar(&inputList, "input-list", "", "Read targets from a file, # starts a comment (also -iL)")
+	scanCmd.Flags().StringVar(&excludeList, "exclude", "", "Hosts, subnets or ranges that must never be scanned, comma-separated")
+	scanCmd.Flags().StringVar(&excludeFile, "exclude-file", "", "Read hosts to exclude from a file")
+	scanCmd.Flags().BoolVar(&resolveAll, "resolve-all", false, "Scan every address a hostname resolves to, not just the first")
+	scanCmd.Flags().BoolVarP(&onlyIPv4, "ipv4", "4", false, "Only scan IPv4 addresses")
+	scanCmd.Flags().BoolVarP(&onlyIPv6, "ipv6", "6", false, "Only scan IPv6 addresses")
+	scanCmd.Flags().BoolVar(&dualStack, "dual-stack", false, "Scan both the IPv4 and the IPv6 address of each hostname")
+	scanCmd.Flags().StringVarP(&ports, "ports", "p", "", "Ports to scan (e.g., 22,80,443 or 1-1000), port sets (web, db, mail, remote-access) or services (ssh,http)")
+	scanCmd.Flags().IntVar(&topPorts, "top-ports", 0, "Scan the N most common TCP ports (up to 1000)")
+	scanCmd.Flags().StringVar(&excludePort, "exclude-ports", "", "Ports never to scan, in the same syntax as --ports")
+	scanCmd.Flags().StringVarP(&timeout, "timeout", "t", fmt.Sprintf("%ds", constants.Timeout), "Connection timeout as a duration (e.g. 300ms, 2s); plain numbers are seconds")
+	scanCmd.Flags().BoolVar(&fixedWait, "fixed-timeout", false, "Always wait the full --timeout instead of adapting it to measured round-trip times")
+	scanCmd.Flags().DurationVar(&minTimeout, "min-timeout", 100*time.Millisecond, "Lower bound of adaptive timeouts")
+	scanCmd.Flags().DurationVar(&maxTimeout, "max-timeout", 0, "Upper bound of adaptive timeouts (default --timeout)")
+	scanCmd.Flags().IntVar(&retries, "retries", 1, "Extra attempts for ports that timed out")
 	scanCmd.Flags().IntVarP(&concurrency, "concurrency", "c", constants.Concurrency, "Maximum concurrent connections")
 	scanCmd.Flags().BoolVarP(&randomize, "randomize", "r", false, "Randomize port scanning order")
 	scanCmd.Flags().IntVarP(&delay, "delay", "d", constants.Delay, "Delay between requests in milliseconds")
-	scanCmd.Flags().BoolVar(&showClosed, "show-closed", false, "Show closed and filtered ports")
-
-	// Mark required flags
-	scanCmd.MarkFlagRequired("host")
+	scanCmd.Flags().Float64Var(&rate, "rate", 0, "Maximum port scans per second across all workers and hosts (0 for no limit)")
+	scanCmd.Flags().IntVar(&burst, "burst", 0, "Scans allowed at once under --rate after an idle period (default rate/10)")
+	scanCmd.Flags().BoolVar(&showClosed, "show-closed", false, "Also show closed, filtered and failed ports (open and open|filtered ports are always shown)")
+	scanCmd.Flags().BoolVar(&udp, "udp", false, "Scan UDP ports using protocol-specific probes")
+	scanCmd.Flags().BoolVar(&noBanner, "no-banner", false, "Skip banner grabbing and only check reachability")
+	scanCmd.Flags().BoolVar(&tlsDetect, "tls-detect", false, "Try a TLS handshake on open ports that answer no plaintext probe, not just known TLS ports")
+	scanCmd.Flags().StringArrayVar(&probeFiles, "probes", nil, "Load additional service probes (nmap-service-probes syntax); repeatable")
+	scanCmd.Flags().IntVar(&intensity, "version-intensity", metronet.DefaultIntensity, "Probe rarity (0-9) up to which probes are sent to ports they are not registered for")
+	scanCmd.Flags().IntVar(&parallel, "parallel-hosts", 0, "Hosts scanned at the same time (default 32, or enough to use every worker under --max-per-host)")
+	scanCmd.Flags().IntVar(&perHost, "max-per-host", 0, "Maximum concurrent connections to a single host (0 for no limit)")
+	scanCmd.Flags().BoolVar(&interleave, "interleave", false, "Sweep each port across all targets before the next port (requires -o ndjson)")
+	scanCmd.Flags().StringSliceVar(&proxies, "proxy", nil, "Scan through socks5://[user:pass@]host:port or http://[user:pass@]host:port proxies, chained in the order given; repeatable")
+	scanCmd.Flags().StringVar(&sourceIP, "source-ip", "", "Send probes from this local address")
+	scanCmd.Flags().IntVar(&sourcePort, "source-port", 0, "Open connections from this local port (e.g. 53 or 88 to test firewall rules); needs --concurrency 1 outside Linux")
+	scanCmd.Flags().StringVar(&iface, "interface", "", "Send probes through this network interface (Linux only)")
+	scanCmd.Flags().IntVar(&redirects, "follow-redirects", 0, "Follow up to N HTTP redirects that stay on the same host")
+	scanCmd.Flags().StringVarP(&outputFmt, "output", "o", string(output.FormatTable), "Output format: table, json or ndjson")
+	scanCmd.Flags().BoolVar(&noProgress, "no-progress", false, "Do not show scan progress on stderr")
+	scanCmd.Flags().StringVar(&checkpointFile, "checkpoint", "", "Save scanned ports to a file so that an interrupted scan can be resumed")
+	scanCmd.Flags().StringVar(&resumeFile, "resume", "", "Resume the scan saved in a checkpoint file, with its original settings")
+	scanCmd.MarkFlagsMutuallyExclusive("checkpoint", "resume")
+	scanCmd.MarkFlagsMutuallyExclusive("ports", "top-ports")
+	scanCmd.MarkFlagsMutuallyExclusive("ipv4", "ipv6", "dual-stack")
 }
 
 func runScan(cmd *cobra.Command, args []string) error {
-	// Validate and parse host
-	hosts, err := network.ParseHosts(host)
+	// A resumed scan takes its settings from the checkpoint
+	var resumed *checkpoint.Checkpoint
+	var previous []metronet.Result
+	if resumeFile != "" {
+		var err error
+		if resumed, err = restoreCheckpoint(cmd); err != nil {
+			return err
+		}
+		previous = resumed.Results
+	}
+
+	// Targets come from the command line, a file or both
+	if host == "" && inputList == "" {
+		return fmt.Errorf("no targets given: use --host or --input-list")
+	}
+
+	format, err := output.ParseFormat(outputFmt)
 	if err != nil {
-		return fmt.Errorf("error parsing host: %v", err)
+		return err
+	}
+
+	if parallel < 0 || perHost < 0 {
+		return fmt.Errorf("--parallel-hosts and --max-per-host cannot be negative")
+	}
+	if rate < 0 || burst < 0 {
+		return fmt.Errorf("--rate and --burst cannot be negative")
+	}
+	connectTimeout, err := parseTimeout(timeout)
+	if err != nil {
+		return err
+	}
+	if retries < 0 || minTimeout < 0 || maxTimeout < 0 {
+		return fmt.Errorf("--retries, --min-timeout and --max-timeout cannot be negative")
+	}
+
+	// Expand targets, resolving hostnames once. A resumed scan reuses the
+	// addresses they resolved to at first, which its saved ports refer to.
+	var resolved map[string][]string
+	if resumed != nil {
+		resolved = resumed.Resolved
+	}
+	targets, err := parseTargets(cmd.Context(), resolved)
+	if err != nil {
+		return err
+	}
+	targetCount := targets.Len()
+	if targetCount == 0 {
+		return fmt.Errorf("no targets left to scan after exclusions")
 	}
 
 	// Parse ports
-	var portList []int
-	if ports != "" {
-		portList, err = network.ParsePortRange(ports)
-		if err != nil {
-			return fmt.Errorf("error parsing ports: %v", err)
+	portList, err := selectPorts()
+	if err != nil {
+		return err
+	}
+
+	// Every TCP connection goes through the proxies, in order
+	var chain *metronet.ProxyChain
+	if len(proxies) > 0 {
+		if chain, err = metronet.ParseProxies(proxies); err != nil {
+			return err
+		}
+		if portList.UDP.Len() > 0 {
+			return fmt.Errorf("UDP ports cannot be scanned through --proxy")
+		}
+		if sourcePort != 0 {
+			return fmt.Errorf("--source-port cannot be used with --proxy")
+		}
+	}
+	source, err := parseSource()
+	if err != nil {
+		return err
+	}
+	if sourcePort != 0 && concurrency > 1 && runtime.GOOS != "linux" {
+		return fmt.Errorf("--source-port needs --concurrency 1 outside Linux, where connections cannot share the port")
+	}
+
+	// An interleaved sweep finishes every host at the same time, so its
+	// results can only be streamed
+	if interleave && format != output.FormatNDJSON {
+		return fmt.Errorf("--interleave requires -o ndjson")
+	}
+
+	// Load service probes
+	engine, err := loadProbes()
+	if err != nil {
+		return err
+	}
+
+	// Arguments are valid; later errors should not print the usage text
+	cmd.SilenceUsage = true
+
+	// Stop the scan on Ctrl-C but keep the results collected so far. A second
+	// Ctrl-C falls back to the default behaviour and exits immediately.
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	// Save every port scanned, whatever the output format
+	saved, err := openCheckpoint(cmd, resumed, targets)
+	if err != nil {
+		return err
+	}
+
+	// Machine-readable formats keep stdout free of anything but results
+	var (
+		report *output.Report
+		stream *output.NDJSONWriter
+	)
+	switch format {
+	case output.FormatJSON:
+		report = output.NewReport(time.Now())
+	case output.FormatNDJSON:
+		stream = output.NewNDJSONWriter(os.Stdout)
+	default:
+		printScanHeader(targetCount, portList, connectTimeout, chain)
+	}
+
+	var onResult func(metronet.Result)
+	if stream != nil || saved != nil {
+		onResult = func(result metronet.Result) {
+			if saved != nil {
+				saved.Write(result)
+			}
+			if stream != nil && shown(result) {
+				stream.WriteResult(result)
+			}
 		}
+	}
+
+	// Results of the interrupted run are streamed ahead of the new ones
+	if stream != nil {
+		for _, result := range filterResults(previous) {
+			stream.WriteResult(result)
+		}
+	}
+
+	opts := scanOptions(engine, connectTimeout)
+	opts = append(opts,
+		metronet.OnResult(onResult),
+		metronet.WithCompleted(previous),
+		metronet.WithProxy(chain),
+		metronet.WithSource(source),
+	)
+
+	// Progress goes to stderr, where it never mixes with results
+	var progress *progressPrinter
+	if !noProgress && !quiet {
+		progress = newProgressPrinter()
+		interval := time.Duration(0)
+		if !progress.tty {
+			interval = pipeInterval
+		}
+		opts = append(opts, metronet.OnProgress(progress.update, interval))
+	}
+	if interleave {
+		// Sweep all targets in constant memory; only totals are known
+		opts = append(opts, metronet.WithInterleave(true), metronet.WithResults(false))
 	} else {
-		portList = scanner.GetAllPorts()
-		fmt.Println("⚠️  Full scan mode: scanning all 65535 ports (this may take a while)")
+		// Report each host as soon as it is done
+		opts = append(opts, metronet.WithResults(format != output.FormatNDJSON))
+		opts = append(opts, metronet.OnHostDone(func(host metronet.HostResult) {
+			switch format {
+			case output.FormatJSON:
+				report.AddHost(host.Target, filterResults(host.Results), host.Stats)
+			case output.FormatNDJSON:
+				stream.WriteStatistics(host.Target, host.Stats)
+			default:
+				if progress != nil {
+					progress.clear()
+				}
+				printHostHeader(host.Target.String())
+				displayResults(host.Results, host.Stats)
+			}
+		}))
 	}
 
-	// Print scan configuration
-	printScanHeader(hosts, portList)
+	_, stats, err := metronet.New(opts...).Scan(ctx, targets, portList)
+	if progress != nil {
+		progress.clear()
+	}
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	switch {
+	case interleave:
+		stream.WriteStatistics(metronet.Target{}, stats)
+	case format == output.FormatTable && targetCount > 1:
+		fmt.Printf("\nAll hosts: %d port(s) in %v (%.1f ports/s)\n", stats.TotalPorts, stats.ScanDuration.Round(time.Millisecond), stats.Rate)
+	}
 
-	// Scan each host
-	for _, targetHost := range hosts {
-		if err := scanHost(targetHost, portList); err != nil {
-			fmt.Fprintf(os.Stderr, "Error scanning %s: %v\n", targetHost, err)
-			continue
+	if stats.ErrorPorts > 0 {
+		logger.Warn("ports failed locally and their state is unknown; for fd-exhausted, raise ulimit -n or lower -c", "ports", stats.ErrorPorts)
+	}
+	if stats.ProxyErrorPorts > 0 {
+		logger.Warn("the proxy failed on some ports and their state is unknown; see the reason column with --show-closed", "ports", stats.ProxyErrorPorts)
+	}
+
+	if saved != nil {
+		if err := saved.Close(); err != nil {
+			return fmt.Errorf("error writing checkpoint: %v", err)
+		}
+	}
+
+	interrupted := ctx.Err() != nil
+	if interrupted {
+		logger.Warn("scan interrupted: results are partial")
+		if saved != nil {
+			logger.Warn("continue the scan with: metronet scan --resume " + savedPath())
+		}
+	}
+
+	switch format {
+	case output.FormatJSON:
+		report.Interrupted = interrupted
+		if err := report.Write(os.Stdout, time.Now()); err != nil {
+			return err
+		}
+	case output.FormatNDJSON:
+		if err := stream.Err(); err != nil {
+			return err
 		}
 	}
 
+	if interrupted {
+		return fmt.Errorf("scan interrupted")
+	}
 	return nil
 }
 
-func scanHost(targetHost string, portList []int) error {
-	fmt.Printf("\n╔═══════════════════════════════════════════════════════════════╗\n")
-	fmt.Printf("║  Scanning Target: %-43s ║\n", targetHost)
-	fmt.Printf("╚═══════════════════════════════════════════════════════════════╝\n\n")
+// parseTargets expands the targets and exclusions given on the command line,
+// taking the addresses of hostnames in resolved from it
+func parseTargets(ctx context.Context, resolved map[string][]string) (*metronet.Targets, error) {
+	specs := metronet.SplitTargets(host)
+	if inputList != "" {
+		listed, err := metronet.ReadTargetFile(inputList)
+		if err != nil {
+			return nil, fmt.Errorf("error reading target list: %v", err)
+		}
+		specs = append(specs, listed...)
+	}
 
-	// Configure scanner
-	config := scanner.ScanConfig{
-		Host:           targetHost,
-		Ports:          portList,
-		Timeout:        time.Duration(timeout) * time.Second,
-		MaxConcurrency: concurrency,
-		RandomizeOrder: randomize,
-		DelayBetween:   time.Duration(delay) * time.Millisecond,
+	exclude := metronet.SplitTargets(excludeList)
+	if excludeFile != "" {
+		listed, err := metronet.ReadTargetFile(excludeFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading exclude file: %v", err)
+		}
+		exclude = append(exclude, listed...)
 	}
 
-	// Create and run scanner
-	s := scanner.NewScanner(config)
-	results, stats, err := s.Scan() // Scan here
+	family := ""
+	switch {
+	case onlyIPv4:
+		family = "ip4"
+	case onlyIPv6:
+		family = "ip6"
+	}
+	targets, err := metronet.ParseTargets(ctx, specs, metronet.TargetOptions{
+		ResolveAll: resolveAll,
+		Exclude:    exclude,
+		Family:     family,
+		DualStack:  dualStack,
+		Resolved:   resolved,
+	})
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("error parsing host: %v", err)
 	}
+	return targets, nil
+}
 
-	// Sort results by port number
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Port < results[j].Port
-	})
+// parseSource builds where probes leave from out of --source-ip,
+// --source-port and --interface
+func parseSource() (metronet.Source, error) {
+	source := metronet.Source{Port: sourcePort, Interface: iface}
+	if sourceIP != "" {
+		if source.IP = net.ParseIP(sourceIP); source.IP == nil {
+			return source, fmt.Errorf("invalid --source-ip %q", sourceIP)
+		}
+	}
+	if err := source.Validate(); err != nil {
+		return source, fmt.Errorf("invalid source: %v", err)
+	}
+	return source, nil
+}
 
-	// Display results
-	displayResults(results, stats)
+// parseTimeout parses the --timeout flag. Plain numbers are seconds, as in
+// earlier versions; anything else is a Go duration such as 300ms.
+func parseTimeout(s string) (time.Duration, error) {
+	value := s
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		value = fmt.Sprintf("%gs", seconds)
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q: use a positive duration such as 300ms or 2s", s)
+	}
+	return d, nil
+}
 
-	return nil
+// scanOptions builds the scanner options shared by all hosts from the
+// command-line flags
+func scanOptions(engine *metronet.Probes, connectTimeout time.Duration) []metronet.Option {
+	return []metronet.Option{
+		metronet.WithTimeout(connectTimeout),
+		metronet.WithAdaptiveTimeout(!fixedWait),
+		metronet.WithTimeoutBounds(minTimeout, maxTimeout),
+		metronet.WithRetries(retries),
+		metronet.WithConcurrency(concurrency),
+		metronet.WithParallelHosts(parallel),
+		metronet.WithMaxPerHost(perHost),
+		metronet.WithRandomOrder(randomize),
+		metronet.WithDelay(time.Duration(delay) * time.Millisecond),
+		metronet.WithRate(rate, burst),
+		metronet.WithBanners(!noBanner),
+		metronet.WithTLSDetection(tlsDetect),
+		metronet.WithProbes(engine),
+		metronet.WithFollowRedirects(redirects),
+		metronet.WithLogger(logger),
+	}
+}
+
+// loadProbes builds the service probe engine from the built-in definitions
+// and any --probes files. It returns nil when the defaults are unchanged.
+func loadProbes() (*metronet.Probes, error) {
+	if intensity < 0 || intensity > 9 {
+		return nil, fmt.Errorf("--version-intensity must be between 0 and 9")
+	}
+	if len(probeFiles) == 0 && intensity == metronet.DefaultIntensity {
+		return nil, nil
+	}
+
+	engine := metronet.DefaultProbes()
+	engine.SetIntensity(intensity)
+	for _, path := range probeFiles {
+		if err := engine.LoadFile(path); err != nil {
+			return nil, fmt.Errorf("error loading probes: %v", err)
+		}
+	}
+	for _, warning := range engine.Warnings() {
+		logger.Warn("probe definition skipped", "detail", warning)
+	}
+	return engine, nil
+}
+
+// selectPorts returns the TCP and UDP ports selected on the command line.
+// Ports without a T: or U: prefix use TCP, or UDP with --udp.
+func selectPorts() (metronet.PortList, error) {
+	var list metronet.PortList
+	var err error
+	untagged := metronet.ProtocolTCP
+	if udp {
+		untagged = metronet.ProtocolUDP
+	}
+	switch {
+	case topPorts != 0:
+		list.Untagged, err = metronet.TopPorts(topPorts)
+		if err != nil {
+			return list, fmt.Errorf("invalid --top-ports: %v", err)
+		}
+	case ports != "":
+		list, err = metronet.ParsePortsFor(ports, untagged)
+		if err != nil {
+			return list, fmt.Errorf("error parsing ports: %v", err)
+		}
+	default:
+		list.Untagged = metronet.AllPorts()
+		logger.Warn("full scan mode: scanning all 65535 ports, this may take a while")
+	}
+	if udp {
+		list.UDP = list.UDP.Union(list.Untagged)
+	} else {
+		list.TCP = list.TCP.Union(list.Untagged)
+	}
+	list.Untagged = metronet.PortSet{}
+
+	if excludePort != "" {
+		excluded, err := metronet.ParsePortsFor(excludePort, untagged)
+		if err != nil {
+			return list, fmt.Errorf("error parsing excluded ports: %v", err)
+		}
+		list.TCP = list.TCP.Without(excluded.Untagged).Without(excluded.TCP)
+		list.UDP = list.UDP.Without(excluded.Untagged).Without(excluded.UDP)
+	}
+	if list.TCP.Len()+list.UDP.Len() == 0 {
+		return list, fmt.Errorf("no ports left to scan after --exclude-ports")
+	}
+	return list, nil
+}
+
+// protocolLabel names the protocols of the selected ports, e.g. "TCP+UDP"
+func protocolLabel(portList metronet.PortList) string {
+	switch {
+	case portList.UDP.Len() == 0:
+		return "TCP"
+	case portList.TCP.Len() == 0:
+		return "UDP"
+	}
+	return "TCP+UDP"
+}
+
+// shown reports whether a result is listed: open ports, and UDP ports that
+// may be open, always are; the rest only with --show-closed
+func shown(result metronet.Result) bool {
+	return showClosed || result.Status == metronet.StatusOpen || result.Status == metronet.StatusOpenFiltered
+}
+
+// filterResults drops closed and filtered ports unless they were requested
+func filterResults(results []metronet.Result) []metronet.Result {
+	if showClosed {
+		return results
+	}
+	filtered := make([]metronet.Result, 0, len(results))
+	for _, result := range results {
+		if shown(result) {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+func printHostHeader(targetHost string) {
+	fmt.Printf("\n╔═══════════════════════════════════════════════════════════════╗\n")
+	fmt.Printf("║  Scanning Target: %-43s ║\n", targetHost)
+	fmt.Printf("╚═══════════════════════════════════════════════════════════════╝\n\n")
 }
 
-func printScanHeader(hosts []string, portList []int) {
+func printScanHeader(targetCount int, portList metronet.PortList, connectTimeout time.Duration, chain *metronet.ProxyChain) {
 	fmt.Println("\n════════════════════════════════════════════════════════════")
 	fmt.Println("    METRONET PORT SCANNER")
 	fmt.Println("════════════════════════════════════════════════════════════")
-	fmt.Printf("Targets:     %d host(s)\n", len(hosts))
-	fmt.Printf("Ports:       %d port(s)\n", len(portList))
-	fmt.Printf("Timeout:     %ds\n", timeout)
+	fmt.Printf("Targets:     %d host(s)\n", targetCount)
+	fmt.Printf("Ports:       %d port(s)\n", portList.TCP.Len()+portList.UDP.Len())
+	fmt.Printf("Protocol:    %s\n", protocolLabel(portList))
+	if fixedWait {
+		fmt.Printf("Timeout:     %v\n", connectTimeout)
+	} else {
+		fmt.Printf("Timeout:     %v (adaptive)\n", connectTimeout)
+	}
 	fmt.Printf("Concurrency: %d\n", concurrency)
 	fmt.Printf("Randomize:   %v\n", randomize)
 	if delay > 0 {
 		fmt.Printf("Delay:       %dms\n", delay)
 	}
+	if rate > 0 {
+		fmt.Printf("Rate:        %g ports/s\n", rate)
+	}
+	if chain != nil {
+		fmt.Printf("Proxy:       %s\n", chain)
+	}
+	if sourceIP != "" || sourcePort != 0 || iface != "" {
+		fmt.Printf("Source:      %s\n", formatSource())
+	}
 	fmt.Println("════════════════════════════════════════════════════════════")
 }
 
-func displayResults(results []scanner.ScanResult, stats scanner.ScanStatistics) {
+func displayResults(results []metronet.Result, stats metronet.Statistics) {
 	// Create table writer
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
 
-	fmt.Fprintln(w, "PORT\tSTATUS\tSERVICE\tBANNER\tBODY")
-	fmt.Fprintln(w, "────\t──────\t───────\t──────\t──────")
+	fmt.Fprintln(w, "PORT\tSTATUS\tREASON\tLATENCY\tSERVICE\tVERSION\tBANNER\tBODY")
+	fmt.Fprintln(w, "────\t──────\t──────\t───────\t───────\t───────\t──────\t──────")
 
 	openCount := 0
 	for _, result := range results {
 		// Skip closed/filtered ports unless requested
-		if !showClosed && result.Status != scanner.StatusOpen {
+		if !shown(result) {
 			continue
 		}
 
-		if result.Status == scanner.StatusOpen {
+		if result.Status == metronet.StatusOpen {
 			openCount++
 		}
 
@@ -174,13 +628,14 @@ func displayResults(results []scanner.ScanResult, stats scanner.ScanStatistics)
 		bannerStr = strings.ReplaceAll(bannerStr, "\n", " ")
 		bannerStr = strings.ReplaceAll(bannerStr, "\r", "")
 
-		fmt.Println("bannerStr: ",bannerStr)
-		fmt.Println("body: ",bodyStr)
-
-		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+		fmt.Fprintf(w, "%d/%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
 			result.Port,
+			result.Protocol,
 			statusStr,
+			result.Reason,
+			formatLatency(result.Latency),
 			result.Service,
+			formatVersion(result),
 			bannerStr,
 			bodyStr,
 		)
@@ -188,6 +643,19 @@ func displayResults(results []scanner.ScanResult, stats scanner.ScanStatistics)
 
 	w.Flush()
 
+	// Print TLS and HTTP details of open ports
+	for _, result := range results {
+		if !shown(result) {
+			continue
+		}
+		if result.TLS != nil {
+			displayTLS(result)
+		}
+		if result.HTTP != nil {
+			displayHTTP(result)
+		}
+	}
+
 	// Print statistics
 	fmt.Printf("\n────────────────────────────────────────────────────────────\n")
 	fmt.Printf("SCAN STATISTICS\n")
@@ -196,7 +664,22 @@ func displayResults(results []scanner.ScanResult, stats scanner.ScanStatistics)
 	fmt.Printf("Open Ports:           %d ✓\n", stats.OpenPorts)
 	fmt.Printf("Closed Ports:         %d\n", stats.ClosedPorts)
 	fmt.Printf("Filtered Ports:       %d\n", stats.FilteredPorts)
+	if stats.OpenFilteredPorts > 0 {
+		fmt.Printf("Open|Filtered Ports:  %d\n", stats.OpenFilteredPorts)
+	}
+	if stats.ErrorPorts > 0 {
+		fmt.Printf("Errors:               %d ✗ (state unknown, see --show-closed)\n", stats.ErrorPorts)
+	}
+	if stats.ProxyErrorPorts > 0 {
+		fmt.Printf("Proxy Errors:         %d ✗ (state unknown, see --show-closed)\n", stats.ProxyErrorPorts)
+	}
 	fmt.Printf("Scan Duration:        %v\n", stats.ScanDuration.Round(time.Millisecond))
+	fmt.Printf("Scan Rate:            %.1f ports/s\n", stats.Rate)
+	if stats.MaxLatency > 0 {
+		fmt.Printf("Latency:              min %s / avg %s / p95 %s / max %s\n",
+			formatLatency(stats.MinLatency), formatLatency(stats.AvgLatency),
+			formatLatency(stats.P95Latency), formatLatency(stats.MaxLatency))
+	}
 	fmt.Printf("────────────────────────────────────────────────────────────\n\n")
 
 	if openCount == 0 {
@@ -206,15 +689,114 @@ func displayResults(results []scanner.ScanResult, stats scanner.ScanStatistics)
 	}
 }
 
-func formatStatus(status scanner.PortStatus) string {
+func displayTLS(result metronet.Result) {
+	info := result.TLS
+	fmt.Printf("\nTLS %d/%s: %s %s", result.Port, result.Protocol, info.Version, info.CipherSuite)
+	if info.ALPN != "" {
+		fmt.Printf(" (ALPN %s)", info.ALPN)
+	}
+	fmt.Println()
+
+	if len(info.Certificates) == 0 {
+		return
+	}
+	leaf := info.Certificates[0]
+	fmt.Printf("  Subject:  %s\n", leaf.Subject)
+	fmt.Printf("  Issuer:   %s\n", leaf.Issuer)
+	if len(leaf.SANs) > 0 {
+		fmt.Printf("  SANs:     %s\n", strings.Join(leaf.SANs, ", "))
+	}
+	fmt.Printf("  Validity: %s - %s\n", leaf.NotBefore.Format(time.DateOnly), leaf.NotAfter.Format(time.DateOnly))
+	fmt.Printf("  Key:      %s", leaf.KeyType)
+	if leaf.SelfSigned {
+		fmt.Printf(" (self-signed)")
+	}
+	fmt.Println()
+}
+
+func displayHTTP(result metronet.Result) {
+	info := result.HTTP
+	fmt.Printf("\nHTTP %d/%s: %s\n", result.Port, result.Protocol, info.Status)
+	if info.Title != "" {
+		fmt.Printf("  Title:    %s\n", info.Title)
+	}
+	if info.Server != "" {
+		fmt.Printf("  Server:   %s\n", info.Server)
+	}
+	if info.PoweredBy != "" {
+		fmt.Printf("  Powered:  %s\n", info.PoweredBy)
+	}
+	if len(info.CookieNames) > 0 {
+		fmt.Printf("  Cookies:  %s\n", strings.Join(info.CookieNames, ", "))
+	}
+	if len(info.SecurityHeaders) > 0 {
+		names := make([]string, 0, len(info.SecurityHeaders))
+		for name := range info.SecurityHeaders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Printf("  Security: %s\n", strings.Join(names, ", "))
+	}
+	if info.Location != "" {
+		fmt.Printf("  Location: %s\n", info.Location)
+	}
+	for _, r := range info.Redirects {
+		fmt.Printf("  -> %d %s", r.StatusCode, r.URL)
+		if r.Title != "" {
+			fmt.Printf(" (%s)", r.Title)
+		}
+		fmt.Println()
+	}
+}
+
+// formatVersion joins the version details of a result the way nmap shows them,
+// e.g. "OpenSSH 8.9p1 (protocol 2.0)"
+func formatVersion(result metronet.Result) string {
+	version := strings.TrimSpace(result.Product + " " + result.Version)
+	if result.ExtraInfo != "" {
+		version = strings.TrimSpace(version + " (" + result.ExtraInfo + ")")
+	}
+	return version
+}
+
+func formatStatus(status metronet.Status) string {
 	switch status {
-	case scanner.StatusOpen:
+	case metronet.StatusOpen:
 		return "OPEN ✓"
-	case scanner.StatusClosed:
+	case metronet.StatusClosed:
 		return "CLOSED"
-	case scanner.StatusFiltered:
+	case metronet.StatusFiltered:
 		return "FILTERED"
+	case metronet.StatusOpenFiltered:
+		return "OPEN|FILTERED"
+	case metronet.StatusError:
+		return "ERROR ✗"
+	case metronet.StatusProxyError:
+		return "PROXY-ERROR ✗"
 	default:
 		return string(status)
 	}
 }
+
+// formatSource describes the source of probes, e.g. "10.0.0.2:53 via eth1"
+func formatSource() string {
+	source := sourceIP
+	if source == "" {
+		source = "*"
+	}
+	if sourcePort != 0 {
+		source = net.JoinHostPort(source, strconv.Itoa(sourcePort))
+	}
+	if iface != "" {
+		source += " via " + iface
+	}
+	return source
+}
+
+// formatLatency shows a latency in milliseconds, or "-" when the port never answered
+func formatLatency(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+}
@@ -2,9 +2,9 @@ module metron_code_jam
 
 go 1.25.0
 
-require github.com/spf13/cobra v1.10.2
-
 require (
-	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.10 // indirect
+	github.com/spf13/cobra v1.10.2
+	github.com/spf13/pflag v1.0.10
 )
+
+require github.com/inconshreveable/mousetrap v1.1.0 // indirect
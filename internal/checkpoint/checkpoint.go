@@ -0,0 +1,232 @@
+// Package checkpoint saves the progress of a scan to a file so that an
+// interrupted scan can be resumed.
+//
+// A checkpoint file is newline-delimited JSON: a header recording the
+// command-line flags of the scan and the addresses its hostnames resolved
+// to, then one line per port scanned. Lines are
+// only ever appended, so a file cut short by a crash loses at most its last,
+// incomplete line, which is cut off before the file is appended to again.
+package checkpoint
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"metron_code_jam/pkg/metronet"
+)
+
+// Version identifies the layout of checkpoint files
+const Version = 1
+
+// flushInterval is how often buffered results are written to disk
+var flushInterval = 5 * time.Second
+
+// header is the first line of a checkpoint file
+type header struct {
+	Version   int                 `json:"checkpoint_version"`
+	Args      []string            `json:"args"`
+	Resolved  map[string][]string `json:"resolved,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+// record is one scanned port. Errors are kept as their message.
+type record struct {
+	metronet.Result
+	Err string `json:",omitempty"`
+}
+
+// Checkpoint is the content of a checkpoint file
+type Checkpoint struct {
+	Args []string // flags the scan was started with
+	// Resolved holds the addresses hostnames resolved to when the scan
+	// started, which a resumed scan reuses so that the ports already
+	// scanned still match its targets
+	Resolved map[string][]string
+	Results  []metronet.Result
+	// Size is the offset just past the last complete line, where Append
+	// continues the file
+	Size int64
+}
+
+// Load reads a checkpoint file. A truncated last line, left by a crash while
+// it was being written, is ignored and left out of Size.
+func Load(path string) (*Checkpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var cp *Checkpoint
+	for {
+		// Every record ends with a newline; a line without one is incomplete
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		if cp == nil {
+			var h header
+			if err := json.Unmarshal(line, &h); err != nil {
+				return nil, fmt.Errorf("%s: not a checkpoint file: %v", path, err)
+			}
+			if h.Version != Version {
+				return nil, fmt.Errorf("%s: unsupported checkpoint version %d", path, h.Version)
+			}
+			cp = &Checkpoint{Args: h.Args, Resolved: h.Resolved, Size: int64(len(line))}
+			continue
+		}
+
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if rec.Err != "" {
+			rec.Result.Err = errors.New(rec.Err)
+		}
+		cp.Results = append(cp.Results, rec.Result)
+		cp.Size += int64(len(line))
+	}
+	if cp == nil {
+		return nil, fmt.Errorf("%s: not a checkpoint file: no header", path)
+	}
+	return cp, nil
+}
+
+// Writer appends scanned ports to a checkpoint file. Results are buffered
+// and flushed to disk every few seconds, even while no new result arrives,
+// and on Close. It is safe for concurrent use.
+type Writer struct {
+	mu      sync.Mutex
+	f       *os.File
+	buf     *bufio.Writer
+	enc     *json.Encoder
+	err     error
+	stop    chan struct{} // closed by Close to stop the flushing goroutine
+	stopped chan struct{} // closed once it has returned
+}
+
+// Create starts a new checkpoint file for a scan run with args, whose
+// hostnames resolved to the addresses in resolved. It fails if the file
+// already exists, so that a checkpoint is never overwritten. Only the owner
+// may read it, since args can hold proxy credentials.
+func Create(path string, args []string, resolved map[string][]string) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("checkpoint %s already exists; resume it with --resume or remove it", path)
+		}
+		return nil, err
+	}
+	w := newWriter(f)
+	w.enc.Encode(header{Version: Version, Args: args, Resolved: resolved, CreatedAt: time.Now().UTC()})
+	if w.err = w.flush(); w.err != nil {
+		w.Close()
+		return nil, w.err
+	}
+	return w, nil
+}
+
+// Append continues a checkpoint file written by an earlier run at size, the
+// Size it was loaded with, dropping any incomplete line after it
+func Append(path string, size int64) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return newWriter(f), nil
+}
+
+func newWriter(f *os.File) *Writer {
+	buf := bufio.NewWriter(f)
+	w := &Writer{
+		f:       f,
+		buf:     buf,
+		enc:     json.NewEncoder(buf),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go w.flushPeriodically()
+	return w
+}
+
+// flushPeriodically flushes buffered results every flushInterval until
+// Close, so that a scan stuck on slow hosts still saves the ports it has
+// already finished
+func (w *Writer) flushPeriodically() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.err == nil && w.buf.Buffered() > 0 {
+				w.err = w.flush()
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// Write records a scanned port
+func (w *Writer) Write(r metronet.Result) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Stop writing after the first failure, such as a full disk
+	if w.err != nil {
+		return w.err
+	}
+	rec := record{Result: r}
+	if r.Err != nil {
+		rec.Err = r.Err.Error()
+	}
+	w.err = w.enc.Encode(rec)
+	return w.err
+}
+
+// Close flushes buffered results and closes the file
+func (w *Writer) Close() error {
+	close(w.stop)
+	<-w.stopped
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err == nil {
+		w.err = w.flush()
+	}
+	if err := w.f.Close(); w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// flush writes buffered results and makes sure they reach the disk
+func (w *Writer) flush() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
@@ -0,0 +1,114 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"metron_code_jam/pkg/metronet"
+)
+
+func result(port int) metronet.Result {
+	return metronet.Result{Host: "10.0.0.1", Port: port, Protocol: metronet.ProtocolTCP, Status: metronet.StatusClosed}
+}
+
+func writeResults(t *testing.T, w *Writer, ports ...int) {
+	t.Helper()
+	for _, port := range ports {
+		if err := w.Write(result(port)); err != nil {
+			t.Fatalf("Write(%d): %v", port, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestAppendAfterPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cp.ndjson")
+	w, err := Create(path, []string{"--host", "scanme.example"}, map[string][]string{"scanme.example": {"10.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeResults(t, w, 22, 80)
+
+	// A crash while a record was being flushed leaves half a line behind
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"Host":"10.0.0.1","Port":44`)
+	f.Close()
+
+	cp, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load after crash: %v", err)
+	}
+	if len(cp.Results) != 2 {
+		t.Fatalf("Load after crash: got %d results, want 2", len(cp.Results))
+	}
+
+	w, err = Append(path, cp.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeResults(t, w, 443)
+
+	cp, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load after resume: %v", err)
+	}
+	var got []int
+	for _, r := range cp.Results {
+		got = append(got, r.Port)
+	}
+	if len(got) != 3 || got[0] != 22 || got[1] != 80 || got[2] != 443 {
+		t.Errorf("Load after resume: got ports %v, want [22 80 443]", got)
+	}
+	if len(cp.Args) != 2 || cp.Args[1] != "scanme.example" {
+		t.Errorf("Load after resume: got args %v", cp.Args)
+	}
+	if addrs := cp.Resolved["scanme.example"]; len(addrs) != 1 || addrs[0] != "10.0.0.1" {
+		t.Errorf("Load after resume: got resolved addresses %v", cp.Resolved)
+	}
+}
+
+func TestLoadRejectsMissingHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cp.ndjson")
+	os.WriteFile(path, []byte(`{"checkpoint_vers`), 0o600)
+	if _, err := Load(path); err == nil {
+		t.Error("Load of a file without a complete header: got no error")
+	}
+}
+
+func TestWriterFlushesWithoutNewResults(t *testing.T) {
+	defer func(d time.Duration) { flushInterval = d }(flushInterval)
+	flushInterval = 10 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "cp.ndjson")
+	w, err := Create(path, []string{"--host", "10.0.0.1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Write(result(22)); err != nil {
+		t.Fatal(err)
+	}
+
+	// No further result arrives, yet port 22 must reach the disk
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		cp, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cp.Results) == 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("port 22 was not flushed while the writer was idle")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,81 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"math"
+	"math/bits"
+	"net/netip"
+	"strings"
+)
+
+// addrRange is an inclusive range of addresses, such as 2001:db8::1-2001:db8::ff
+type addrRange struct {
+	first, last netip.Addr
+	n           int
+}
+
+// parseIPv6Range parses a range of IPv6 addresses. The end is either a full
+// address or the last group of one (2001:db8::10-1f). Ranges of more than
+// limit addresses are rejected.
+func parseIPv6Range(spec string, limit int) (addrRange, error) {
+	loStr, hiStr, _ := strings.Cut(spec, "-")
+	first, err := netip.ParseAddr(loStr)
+	if err != nil || !first.Is6() {
+		return addrRange{}, fmt.Errorf("invalid IPv6 address %q", loStr)
+	}
+
+	// A bare group replaces the last group of the first address
+	if !strings.Contains(hiStr, ":") {
+		i := strings.LastIndex(loStr, ":")
+		hiStr = loStr[:i+1] + hiStr
+	}
+	last, err := netip.ParseAddr(hiStr)
+	if err != nil || !last.Is6() {
+		return addrRange{}, fmt.Errorf("invalid IPv6 address %q", hiStr)
+	}
+	if last.Less(first) {
+		return addrRange{}, fmt.Errorf("address range is reversed")
+	}
+
+	n, ok := rangeSize(first, last)
+	if !ok || n > limit {
+		return addrRange{}, fmt.Errorf("range holds more than %d addresses", limit)
+	}
+	return addrRange{first: first, last: last, n: n}, nil
+}
+
+// rangeSize counts the addresses from first to last, reporting false when
+// they do not fit in an int
+func rangeSize(first, last netip.Addr) (int, bool) {
+	a, b := first.As16(), last.As16()
+	lo, borrow := bits.Sub64(binary.BigEndian.Uint64(b[8:]), binary.BigEndian.Uint64(a[8:]), 0)
+	hi, _ := bits.Sub64(binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(a[:8]), borrow)
+	if hi != 0 || lo >= math.MaxInt64 {
+		return 0, false
+	}
+	return int(lo) + 1, true
+}
+
+func (r addrRange) all() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		for addr := r.first; addr.IsValid() && !r.last.Less(addr); addr = addr.Next() {
+			if !yield(addr) {
+				return
+			}
+		}
+	}
+}
+
+func (r addrRange) contains(addr netip.Addr) bool {
+	return addr.BitLen() == r.first.BitLen() && !addr.Less(r.first) && !r.last.Less(addr)
+}
+
+func (r addrRange) generates(addr netip.Addr) bool {
+	return r.contains(addr)
+}
+
+func (r addrRange) size() int {
+	return r.n
+}
@@ -0,0 +1,233 @@
+package network
+
+import (
+	"cmp"
+	"fmt"
+	"iter"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PortRange is an inclusive range of ports
+type PortRange struct {
+	First, Last int
+}
+
+// PortSet is a list of port ranges. Ports are generated on demand rather
+// than stored one by one.
+type PortSet struct {
+	ranges []PortRange
+}
+
+// NewPortSet returns a set holding the given ranges, in order
+func NewPortSet(ranges ...PortRange) PortSet {
+	return PortSet{ranges: ranges}
+}
+
+// AllPorts returns the set of every port (1-65535)
+func AllPorts() PortSet {
+	return NewPortSet(PortRange{1, 65535})
+}
+
+// Len returns the number of ports in the set
+func (p PortSet) Len() int {
+	n := 0
+	for _, r := range p.ranges {
+		n += r.Last - r.First + 1
+	}
+	return n
+}
+
+// At returns the i-th port of the set, counting from 0
+func (p PortSet) At(i int) int {
+	for _, r := range p.ranges {
+		if size := r.Last - r.First + 1; i >= size {
+			i -= size
+			continue
+		}
+		return r.First + i
+	}
+	panic(fmt.Sprintf("port index %d out of range", i))
+}
+
+// All yields the ports of the set in order
+func (p PortSet) All() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for _, r := range p.ranges {
+			for port := r.First; port <= r.Last; port++ {
+				if !yield(port) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Without returns the ports of p that are not in exclude, in the same order
+func (p PortSet) Without(exclude PortSet) PortSet {
+	remaining := p.ranges
+	for _, ex := range exclude.ranges {
+		var next []PortRange
+		for _, r := range remaining {
+			if ex.Last < r.First || ex.First > r.Last {
+				next = append(next, r)
+				continue
+			}
+			if r.First < ex.First {
+				next = append(next, PortRange{r.First, ex.First - 1})
+			}
+			if r.Last > ex.Last {
+				next = append(next, PortRange{ex.Last + 1, r.Last})
+			}
+		}
+		remaining = next
+	}
+	return PortSet{ranges: remaining}
+}
+
+// Union returns the ports in p or other, sorted and without duplicates
+func (p PortSet) Union(other PortSet) PortSet {
+	return PortSet{ranges: append(slices.Clone(p.ranges), other.ranges...)}.normalize()
+}
+
+// normalize sorts the ranges and merges those that overlap or touch
+func (p PortSet) normalize() PortSet {
+	if len(p.ranges) == 0 {
+		return p
+	}
+	ranges := slices.Clone(p.ranges)
+	slices.SortFunc(ranges, func(a, b PortRange) int {
+		return cmp.Compare(a.First, b.First)
+	})
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.First <= last.Last+1 {
+			last.Last = max(last.Last, r.Last)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return PortSet{ranges: merged}
+}
+
+// PortList is a port specification whose entries may be tagged with a
+// transport protocol, nmap style: in "22,T:80,U:53,161" port 22 is untagged,
+// 80 is TCP and 53 and 161 are UDP
+type PortList struct {
+	Untagged PortSet // entries before any prefix
+	TCP      PortSet
+	UDP      PortSet
+}
+
+// ParsePortList parses a comma-separated port specification. An entry is a
+// port, a range that may be open at either end (1-1024, -1024, 8000-), the
+// name of a port set (web, db, mail, remote-access) or of a service (ssh).
+// A T: or U: prefix tags its entry and the ones after it as TCP or UDP.
+// Service names are looked up for the protocol of their prefix, or for
+// untagged ("tcp" or "udp"), the protocol untagged entries will be scanned
+// over. Each set comes back sorted and without duplicates.
+func ParsePortList(s string, untagged string) (PortList, error) {
+	var list PortList
+	if strings.TrimSpace(s) == "" {
+		return list, nil
+	}
+
+	current, protocol := &list.Untagged, untagged
+	for i, entry := range strings.Split(s, ",") {
+		token := strings.TrimSpace(entry)
+		if prefix, rest, ok := strings.Cut(token, ":"); ok {
+			switch strings.ToUpper(strings.TrimSpace(prefix)) {
+			case "T":
+				current, protocol = &list.TCP, "tcp"
+			case "U":
+				current, protocol = &list.UDP, "udp"
+			default:
+				return list, fmt.Errorf("entry %d %q: unknown protocol prefix %q (expected T: or U:)", i+1, token, prefix+":")
+			}
+			token = strings.TrimSpace(rest)
+		}
+
+		ranges, err := parsePortEntry(token, protocol)
+		if err != nil {
+			return list, fmt.Errorf("entry %d %q: %v", i+1, strings.TrimSpace(entry), err)
+		}
+		current.ranges = append(current.ranges, ranges...)
+	}
+
+	list.Untagged = list.Untagged.normalize()
+	list.TCP = list.TCP.normalize()
+	list.UDP = list.UDP.normalize()
+	return list, nil
+}
+
+// ParsePortRange parses a port specification without protocol prefixes
+// (e.g., "1-1024", "80", "22,80,443", "web,ssh"), looking service names up
+// as TCP services; see ParsePortList
+func ParsePortRange(portStr string) (PortSet, error) {
+	list, err := ParsePortList(portStr, "tcp")
+	if err != nil {
+		return PortSet{}, err
+	}
+	if list.TCP.Len() > 0 || list.UDP.Len() > 0 {
+		return PortSet{}, fmt.Errorf("protocol prefixes (T:, U:) are not allowed here")
+	}
+	return list.Untagged, nil
+}
+
+// parsePortEntry parses one entry of a port specification, looking service
+// names up for protocol
+func parsePortEntry(token, protocol string) ([]PortRange, error) {
+	if token == "" {
+		return nil, fmt.Errorf("empty entry")
+	}
+
+	// Names start with a letter
+	if isLetter(token[0]) {
+		named, err := namedPorts(token, protocol)
+		return named.ranges, err
+	}
+
+	lo, hi, isRange := strings.Cut(token, "-")
+	if !isRange {
+		port, err := parsePort(token)
+		if err != nil {
+			return nil, err
+		}
+		return []PortRange{{port, port}}, nil
+	}
+
+	// Either end of a range may be left open
+	r := PortRange{1, 65535}
+	var err error
+	if lo = strings.TrimSpace(lo); lo != "" {
+		if r.First, err = parsePort(lo); err != nil {
+			return nil, err
+		}
+	}
+	if hi = strings.TrimSpace(hi); hi != "" {
+		if r.Last, err = parsePort(hi); err != nil {
+			return nil, err
+		}
+	}
+	if r.First > r.Last {
+		return nil, fmt.Errorf("range is reversed (did you mean %d-%d?)", r.Last, r.First)
+	}
+	return []PortRange{r}, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a port number", s)
+	}
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("port %d is out of range 1-65535", port)
+	}
+	return port, nil
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
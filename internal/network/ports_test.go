@@ -0,0 +1,109 @@
+package network
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPortSet(t *testing.T) {
+	set := NewPortSet(PortRange{1, 3}, PortRange{80, 80}, PortRange{8000, 8001})
+	if n := set.Len(); n != 6 {
+		t.Errorf("Len = %d, want 6", n)
+	}
+	if got := slices.Collect(set.All()); !slices.Equal(got, []int{1, 2, 3, 80, 8000, 8001}) {
+		t.Errorf("All = %v", got)
+	}
+	for i, want := range map[int]int{0: 1, 3: 80, 5: 8001} {
+		if got := set.At(i); got != want {
+			t.Errorf("At(%d) = %d, want %d", i, got, want)
+		}
+	}
+
+	all := AllPorts()
+	if all.Len() != 65535 || all.At(0) != 1 || all.At(65534) != 65535 {
+		t.Errorf("AllPorts has %d ports from %d to %d", all.Len(), all.At(0), all.At(all.Len()-1))
+	}
+}
+
+func TestParsePortList(t *testing.T) {
+	tests := []struct {
+		spec     string
+		untagged []int
+		tcp      []int
+		udp      []int
+	}{
+		{spec: "", untagged: nil},
+		{spec: "80", untagged: []int{80}},
+		{spec: "443, 22,80,22", untagged: []int{22, 80, 443}},
+		{spec: "20-23,21", untagged: []int{20, 21, 22, 23}},
+		{spec: "-3", untagged: []int{1, 2, 3}},
+		{spec: "65533-", untagged: []int{65533, 65534, 65535}},
+		{spec: "mail", untagged: []int{25, 110, 143, 465, 587, 993, 995, 2525}},
+		{spec: "22,T:80,U:53,161", untagged: []int{22}, tcp: []int{80}, udp: []int{53, 161}},
+		{spec: "t:80,u:53", tcp: []int{80}, udp: []int{53}},
+	}
+	for _, tt := range tests {
+		list, err := ParsePortList(tt.spec, "tcp")
+		if err != nil {
+			t.Errorf("ParsePortList(%q): %v", tt.spec, err)
+			continue
+		}
+		for _, set := range []struct {
+			name string
+			got  PortSet
+			want []int
+		}{
+			{"untagged", list.Untagged, tt.untagged},
+			{"TCP", list.TCP, tt.tcp},
+			{"UDP", list.UDP, tt.udp},
+		} {
+			if got := slices.Collect(set.got.All()); !slices.Equal(got, set.want) {
+				t.Errorf("ParsePortList(%q) %s = %v, want %v", tt.spec, set.name, got, set.want)
+			}
+		}
+	}
+}
+
+func TestParsePortListErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"0", "out of range"},
+		{"65536", "out of range"},
+		{"90-80", "reversed"},
+		{"80,,443", "empty entry"},
+		{"http-", "unknown port set or service"},
+		{"x80", "unknown port set or service"},
+		{"S:80", "unknown protocol prefix"},
+		{"1.5", "not a port number"},
+	}
+	for _, tt := range tests {
+		_, err := ParsePortList(tt.spec, "tcp")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParsePortList(%q) error = %v, want %q", tt.spec, err, tt.want)
+		}
+	}
+}
+
+func TestParsePortRangeRejectsPrefixes(t *testing.T) {
+	if _, err := ParsePortRange("T:80"); err == nil {
+		t.Error("ParsePortRange accepted a protocol prefix")
+	}
+}
+
+func TestPortSetWithout(t *testing.T) {
+	set, err := ParsePortRange("1-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exclude, err := ParsePortRange("1,4-6,10-20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := slices.Collect(set.Without(exclude).All())
+	if want := []int{2, 3, 7, 8, 9}; !slices.Equal(got, want) {
+		t.Errorf("Without = %v, want %v", got, want)
+	}
+}
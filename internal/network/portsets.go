@@ -0,0 +1,69 @@
+package network
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed top-ports
+var topPortsList string
+
+var (
+	topPortsOnce sync.Once
+	topPorts     []int
+)
+
+// NamedPortSets are the symbolic port sets accepted by ParsePortRange
+var NamedPortSets = map[string]string{
+	"web":           "80,81,443,591,593,3000,5000,8000,8008,8080,8081,8443,8888,9443",
+	"db":            "1433,1434,1521,3306,5432,5984,6379,7474,8086,9042,9200,9300,11211,27017,27018",
+	"mail":          "25,110,143,465,587,993,995,2525",
+	"remote-access": "22,23,512-514,2222,3389,5800,5900-5903,5938,5985,5986",
+}
+
+// TopPorts returns the n TCP ports most often found open, most frequent
+// first. The embedded list holds the top 1000.
+func TopPorts(n int) (PortSet, error) {
+	topPortsOnce.Do(func() {
+		sc := bufio.NewScanner(strings.NewReader(topPortsList))
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			port, err := strconv.Atoi(line)
+			if err != nil {
+				panic("network: invalid built-in top ports: " + line)
+			}
+			topPorts = append(topPorts, port)
+		}
+	})
+
+	if n < 1 || n > len(topPorts) {
+		return PortSet{}, fmt.Errorf("top ports must be between 1 and %d", len(topPorts))
+	}
+	var set PortSet
+	for _, port := range topPorts[:n] {
+		set.ranges = append(set.ranges, PortRange{port, port})
+	}
+	return set, nil
+}
+
+// namedPorts resolves a port set name such as "web", or a service name such
+// as "ssh" offered over protocol, to its ports
+func namedPorts(name, protocol string) (PortSet, error) {
+	name = strings.ToLower(name)
+	if spec, ok := NamedPortSets[name]; ok {
+		return ParsePortRange(spec)
+	}
+	port, err := net.LookupPort(protocol, name)
+	if err != nil {
+		return PortSet{}, fmt.Errorf("unknown port set or service")
+	}
+	return NewPortSet(PortRange{port, port}), nil
+}
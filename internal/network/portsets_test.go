@@ -0,0 +1,81 @@
+package network
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTopPortsRank(t *testing.T) {
+	tests := []struct {
+		port int
+		rank int
+	}{
+		{80, 1},
+		{3389, 7},
+		{5900, 20},
+		{1025, 21},
+		{1000, 101},
+		{5901, 133},
+		{1080, 167},
+	}
+	all, err := TopPorts(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := all.At(tt.rank - 1); got != tt.port {
+			t.Errorf("rank %d: got port %d, want %d", tt.rank, got, tt.port)
+		}
+	}
+}
+
+func TestTopPortsUnique(t *testing.T) {
+	all, err := TopPorts(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[int]bool)
+	for port := range all.All() {
+		if seen[port] {
+			t.Errorf("port %d listed twice", port)
+		}
+		seen[port] = true
+	}
+	if len(seen) != 1000 {
+		t.Errorf("got %d ports, want 1000", len(seen))
+	}
+	if _, err := TopPorts(1001); err == nil {
+		t.Error("TopPorts(1001) succeeded")
+	}
+}
+
+func TestNamedPortsProtocol(t *testing.T) {
+	tests := []struct {
+		spec     string
+		untagged string
+		want     PortList
+	}{
+		{"U:ntp", "tcp", PortList{UDP: NewPortSet(PortRange{123, 123})}},
+		{"T:ssh,U:ntp", "tcp", PortList{TCP: NewPortSet(PortRange{22, 22}), UDP: NewPortSet(PortRange{123, 123})}},
+		{"ntp", "udp", PortList{Untagged: NewPortSet(PortRange{123, 123})}},
+	}
+	for _, tt := range tests {
+		list, err := ParsePortList(tt.spec, tt.untagged)
+		if err != nil {
+			t.Errorf("ParsePortList(%q, %q): %v", tt.spec, tt.untagged, err)
+			continue
+		}
+		for _, set := range []struct {
+			name      string
+			got, want PortSet
+		}{
+			{"untagged", list.Untagged, tt.want.Untagged},
+			{"TCP", list.TCP, tt.want.TCP},
+			{"UDP", list.UDP, tt.want.UDP},
+		} {
+			if got, want := slices.Collect(set.got.All()), slices.Collect(set.want.All()); !slices.Equal(got, want) {
+				t.Errorf("ParsePortList(%q, %q) %s = %v, want %v", tt.spec, tt.untagged, set.name, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,569 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"iter"
+	"maps"
+	"math"
+	"math/bits"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Target is a single address to scan
+type Target struct {
+	IP       string // address to connect to
+	Hostname string // name the address was resolved from; empty for IP targets
+}
+
+// String returns the target as shown to users, e.g. "example.com (93.184.215.14)"
+func (t Target) String() string {
+	if t.Hostname == "" {
+		return t.IP
+	}
+	return fmt.Sprintf("%s (%s)", t.Hostname, t.IP)
+}
+
+// TargetOptions controls how target specifications are expanded
+type TargetOptions struct {
+	ResolveAll bool     // scan every address of a hostname, not just the first
+	Exclude    []string // specifications of hosts that must never be scanned
+	// Family limits targets to "ip4" or "ip6" addresses; both are allowed
+	// when empty
+	Family string
+	// DualStack scans the first IPv4 and the first IPv6 address of each
+	// hostname instead of only the first address
+	DualStack bool
+	// MaxIPv6 caps the addresses of an IPv6 prefix or range;
+	// DefaultMaxIPv6 when zero
+	MaxIPv6 int
+	// Resolved holds addresses to use for hostnames instead of looking them
+	// up, as returned by TargetSet.Resolved, so that a scan run again
+	// covers the same addresses even if DNS has changed since
+	Resolved map[string][]netip.Addr
+}
+
+// DefaultMaxIPv6 is the largest IPv6 prefix or range scanned by default: a
+// /112. Larger ones would never finish.
+const DefaultMaxIPv6 = 1 << 16
+
+// addressSet is the set of addresses described by a target specification
+type addressSet interface {
+	all() iter.Seq[netip.Addr]
+	// contains reports whether addr falls within the specification, and
+	// generates whether all yields it, which leaves out the network and
+	// broadcast addresses of IPv4 subnets
+	contains(addr netip.Addr) bool
+	generates(addr netip.Addr) bool
+	size() int
+}
+
+// TargetSet is the set of targets described by a list of specifications.
+// Addresses are generated on demand, so even a /8 takes constant memory.
+type TargetSet struct {
+	specs    []targetSpec
+	exclude  []addressSet
+	resolved map[string][]netip.Addr
+}
+
+// targetSpec is a parsed target specification
+type targetSpec struct {
+	sets     []addressSet
+	hostname string // set when the specification was a hostname
+}
+
+// ParseTargets parses target specifications into the set of addresses to
+// scan. A specification is an IP address, a hostname, a CIDR subnet or an
+// IPv4 address with octet ranges such as 10.0.0.1-40 or 10.0.1-3.0/24.
+// Hostnames are resolved once, here. Addresses matching opts.Exclude are
+// left out.
+func ParseTargets(ctx context.Context, specs []string, opts TargetOptions) (*TargetSet, error) {
+	if opts.MaxIPv6 <= 0 {
+		opts.MaxIPv6 = DefaultMaxIPv6
+	}
+	// Lookups are added to a copy, leaving the caller's map alone
+	opts.Resolved = maps.Clone(opts.Resolved)
+	if opts.Resolved == nil {
+		opts.Resolved = make(map[string][]netip.Addr)
+	}
+
+	ts := &TargetSet{resolved: opts.Resolved}
+	for _, spec := range opts.Exclude {
+		// Exclusions cover every address and are never too large
+		sets, _, err := parseSpec(ctx, spec, TargetOptions{ResolveAll: true, MaxIPv6: math.MaxInt, Resolved: opts.Resolved})
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclusion: %v", err)
+		}
+		for _, set := range sets {
+			// Exclusions keep the edges of their subnets, so walking one
+			// yields every address it contains
+			if r, ok := set.(ipv4Range); ok {
+				r.subnet = 32
+				set = r
+			}
+			ts.exclude = append(ts.exclude, set)
+		}
+	}
+
+	for _, spec := range specs {
+		sets, hostname, err := parseSpec(ctx, spec, opts)
+		if err != nil {
+			return nil, err
+		}
+		ts.specs = append(ts.specs, targetSpec{sets: sets, hostname: hostname})
+	}
+	return ts, nil
+}
+
+// All yields the targets in the order they were specified. It can be called
+// any number of times.
+func (ts *TargetSet) All() iter.Seq[Target] {
+	return func(yield func(Target) bool) {
+		for _, spec := range ts.specs {
+			for _, set := range spec.sets {
+				for addr := range set.all() {
+					if excluded(ts.exclude, addr) {
+						continue
+					}
+					if !yield(Target{IP: addr.String(), Hostname: spec.hostname}) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// Resolved returns the addresses each hostname resolved to, including those
+// left out by TargetOptions; pass them as TargetOptions.Resolved to expand
+// the same specifications into the same targets again
+func (ts *TargetSet) Resolved() map[string][]netip.Addr {
+	return maps.Clone(ts.resolved)
+}
+
+// Len returns the number of targets: the size of each specification, less
+// the excluded addresses it holds
+func (ts *TargetSet) Len() int {
+	excludedSize := 0
+	for _, set := range ts.exclude {
+		if size := set.size(); size > math.MaxInt-excludedSize {
+			excludedSize = math.MaxInt
+		} else {
+			excludedSize += size
+		}
+	}
+
+	n := 0
+	for _, spec := range ts.specs {
+		for _, set := range spec.sets {
+			n += set.size()
+			if len(ts.exclude) > 0 {
+				n -= ts.excludedFrom(set, excludedSize)
+			}
+		}
+	}
+	return n
+}
+
+// excludedFrom counts the excluded addresses of set. It walks set or the
+// exclusions, whichever holds fewer addresses, so a /8 with a few hosts
+// carved out is counted without expanding it.
+func (ts *TargetSet) excludedFrom(set addressSet, excludedSize int) int {
+	n := 0
+	if set.size() <= excludedSize {
+		for addr := range set.all() {
+			if excluded(ts.exclude, addr) {
+				n++
+			}
+		}
+		return n
+	}
+	for i, exclusion := range ts.exclude {
+		for addr := range exclusion.all() {
+			// An address covered by several exclusions counts once
+			if set.generates(addr) && !excluded(ts.exclude[:i], addr) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// SplitTargets splits a list of target specifications separated by commas
+// or whitespace
+func SplitTargets(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+}
+
+// ReadTargetFile reads target specifications from a file. Each line holds
+// one or more specifications; everything after a # is a comment.
+func ReadTargetFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var specs []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		specs = append(specs, SplitTargets(line)...)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return specs, nil
+}
+
+// parseSpec parses a single target specification. Hostnames are resolved
+// according to opts and returned alongside the addresses.
+func parseSpec(ctx context.Context, spec string, opts TargetOptions) ([]addressSet, string, error) {
+	// IPv6 literals may be bracketed, as in URLs: [::1] or [2001:db8::]/120
+	if rest, ok := strings.CutPrefix(spec, "["); ok {
+		addr, suffix, found := strings.Cut(rest, "]")
+		if !found {
+			return nil, "", fmt.Errorf("invalid target %q: missing ]", spec)
+		}
+		spec = addr + suffix
+	}
+
+	if isIPv4Spec(spec) {
+		if opts.Family == "ip6" {
+			return nil, "", fmt.Errorf("target %q is IPv4 but only IPv6 was requested", spec)
+		}
+		r, err := parseIPv4Range(spec)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid target %q: %v", spec, err)
+		}
+		return []addressSet{r}, "", nil
+	}
+
+	if strings.Contains(spec, ":") && strings.Contains(spec, "-") {
+		r, err := parseIPv6Range(spec, opts.MaxIPv6)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid target %q: %v", spec, err)
+		}
+		return []addressSet{r}, "", checkFamily(spec, r.first, opts.Family)
+	}
+
+	if strings.Contains(spec, "/") {
+		prefix, err := netip.ParsePrefix(spec)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid CIDR notation %q", spec)
+		}
+		set := prefixSet{prefix.Masked()}
+		if set.size() > opts.MaxIPv6 {
+			return nil, "", fmt.Errorf("IPv6 prefix %q is too large to scan: use a /%d or longer prefix, or an explicit range", spec, 128-bits.Len(uint(opts.MaxIPv6))+1)
+		}
+		return []addressSet{set}, "", checkFamily(spec, prefix.Addr(), opts.Family)
+	}
+
+	if addr, err := netip.ParseAddr(spec); err == nil {
+		addr = addr.Unmap()
+		return []addressSet{single{addr}}, "", checkFamily(spec, addr, opts.Family)
+	}
+
+	return resolveSpec(ctx, spec, opts)
+}
+
+// resolveSpec resolves a hostname to its first address, the first of each
+// family with DualStack, or all of them with ResolveAll. Hostnames already
+// in opts.Resolved are not looked up again; others are added to it.
+func resolveSpec(ctx context.Context, spec string, opts TargetOptions) ([]addressSet, string, error) {
+	found := opts.Resolved[spec]
+	if len(found) == 0 {
+		// Both families are looked up, so that the addresses can be
+		// reused whatever the family of the specification using them
+		lookedUp, err := net.DefaultResolver.LookupNetIP(ctx, "ip", spec)
+		if err != nil || len(lookedUp) == 0 {
+			return nil, "", fmt.Errorf("failed to resolve %q: %v", spec, err)
+		}
+		for _, addr := range lookedUp {
+			found = append(found, addr.Unmap())
+		}
+		if opts.Resolved != nil {
+			opts.Resolved[spec] = found
+		}
+	}
+
+	var addrs []netip.Addr
+	for _, addr := range found {
+		if opts.Family == "ip4" && !addr.Is4() || opts.Family == "ip6" && !addr.Is6() {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return nil, "", fmt.Errorf("failed to resolve %q: no %s address", spec, familyName(opts.Family))
+	}
+
+	var picked []netip.Addr
+	switch {
+	case opts.ResolveAll:
+		picked = addrs
+	case opts.DualStack:
+		var have4, have6 bool
+		for _, addr := range addrs {
+			if addr = addr.Unmap(); addr.Is4() && !have4 || addr.Is6() && !have6 {
+				picked = append(picked, addr)
+				have4, have6 = have4 || addr.Is4(), have6 || addr.Is6()
+			}
+		}
+	default:
+		picked = addrs[:1]
+	}
+
+	sets := make([]addressSet, 0, len(picked))
+	for _, addr := range picked {
+		sets = append(sets, single{addr.Unmap()})
+	}
+	return sets, spec, nil
+}
+
+// familyName returns the name users know an address family by
+func familyName(family string) string {
+	if family == "ip6" {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+// checkFamily reports an error when addr is not of the requested family
+func checkFamily(spec string, addr netip.Addr, family string) error {
+	switch {
+	case family == "ip4" && !addr.Is4():
+		return fmt.Errorf("target %q is IPv6 but only IPv4 was requested", spec)
+	case family == "ip6" && !addr.Is6():
+		return fmt.Errorf("target %q is IPv4 but only IPv6 was requested", spec)
+	}
+	return nil
+}
+
+// excluded reports whether addr belongs to one of the excluded sets
+func excluded(exclude []addressSet, addr netip.Addr) bool {
+	for _, set := range exclude {
+		if set.contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// single is a set holding one address
+type single struct {
+	addr netip.Addr
+}
+
+func (s single) all() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		yield(s.addr)
+	}
+}
+
+func (s single) contains(addr netip.Addr) bool {
+	return s.addr == addr
+}
+
+func (s single) generates(addr netip.Addr) bool {
+	return s.contains(addr)
+}
+
+func (s single) size() int {
+	return 1
+}
+
+// prefixSet is a subnet given in CIDR notation that is not plain IPv4,
+// e.g. an IPv6 prefix
+type prefixSet struct {
+	prefix netip.Prefix
+}
+
+func (p prefixSet) all() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		for addr := p.prefix.Addr(); p.prefix.Contains(addr); addr = addr.Next() {
+			if !yield(addr) {
+				return
+			}
+		}
+	}
+}
+
+func (p prefixSet) contains(addr netip.Addr) bool {
+	return p.prefix.Contains(addr)
+}
+
+func (p prefixSet) generates(addr netip.Addr) bool {
+	return p.contains(addr)
+}
+
+func (p prefixSet) size() int {
+	hostBits := p.prefix.Addr().BitLen() - p.prefix.Bits()
+	if hostBits >= 62 {
+		return math.MaxInt
+	}
+	return 1 << hostBits
+}
+
+// octetRange is an inclusive range of values of one IPv4 octet
+type octetRange struct {
+	lo, hi int
+}
+
+// ipv4Range is a set of IPv4 addresses given by a range for each octet. CIDR
+// subnets are stored the same way, with the host bits ranging over all values.
+type ipv4Range struct {
+	octets [4]octetRange
+	// subnet is the prefix length of a CIDR specification. The network and
+	// broadcast addresses of each subnet are skipped when it holds more
+	// than two addresses.
+	subnet int
+}
+
+// isIPv4Spec reports whether spec only uses the characters of an IPv4 address,
+// octet ranges and a prefix length
+func isIPv4Spec(spec string) bool {
+	if !strings.Contains(spec, ".") {
+		return false
+	}
+	for _, r := range spec {
+		if (r < '0' || r > '9') && r != '.' && r != '-' && r != '*' && r != '/' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseIPv4Range parses an IPv4 address whose octets may be ranges (10-20)
+// or wildcards (*), optionally followed by a prefix length
+func parseIPv4Range(spec string) (ipv4Range, error) {
+	r := ipv4Range{subnet: 32}
+
+	addr, bits, hasPrefix := strings.Cut(spec, "/")
+	if hasPrefix {
+		n, err := strconv.Atoi(bits)
+		if err != nil || n < 0 || n > 32 {
+			return r, fmt.Errorf("invalid prefix length %q", bits)
+		}
+		r.subnet = n
+	}
+
+	parts := strings.Split(addr, ".")
+	if len(parts) != 4 {
+		return r, fmt.Errorf("expected 4 octets, got %d", len(parts))
+	}
+	for i, part := range parts {
+		o, err := parseOctetRange(part)
+		if err != nil {
+			return r, err
+		}
+
+		// Host bits of the prefix cover every value they can take
+		hostBits := min(max(8*(i+1)-r.subnet, 0), 8)
+		mask := 0xff << hostBits & 0xff
+		o.lo &= mask
+		o.hi |= ^mask & 0xff
+		r.octets[i] = o
+	}
+	return r, nil
+}
+
+// parseOctetRange parses one octet of an IPv4 range specification
+func parseOctetRange(s string) (octetRange, error) {
+	if s == "*" {
+		return octetRange{0, 255}, nil
+	}
+
+	loStr, hiStr, isRange := strings.Cut(s, "-")
+	lo, err := parseOctet(loStr)
+	if err != nil {
+		return octetRange{}, err
+	}
+	if !isRange {
+		return octetRange{lo, lo}, nil
+	}
+	hi, err := parseOctet(hiStr)
+	if err != nil {
+		return octetRange{}, err
+	}
+	if lo > hi {
+		return octetRange{}, fmt.Errorf("octet range %q is reversed", s)
+	}
+	return octetRange{lo, hi}, nil
+}
+
+func parseOctet(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 255 {
+		return 0, fmt.Errorf("invalid octet %q", s)
+	}
+	return n, nil
+}
+
+func (r ipv4Range) all() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		o := r.octets
+		for a := o[0].lo; a <= o[0].hi; a++ {
+			for b := o[1].lo; b <= o[1].hi; b++ {
+				for c := o[2].lo; c <= o[2].hi; c++ {
+					for d := o[3].lo; d <= o[3].hi; d++ {
+						addr := netip.AddrFrom4([4]byte{byte(a), byte(b), byte(c), byte(d)})
+						if r.isSubnetEdge(addr) {
+							continue
+						}
+						if !yield(addr) {
+							return
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func (r ipv4Range) contains(addr netip.Addr) bool {
+	if !addr.Is4() {
+		return false
+	}
+	b := addr.As4()
+	for i, o := range r.octets {
+		if int(b[i]) < o.lo || int(b[i]) > o.hi {
+			return false
+		}
+	}
+	return true
+}
+
+func (r ipv4Range) generates(addr netip.Addr) bool {
+	return r.contains(addr) && !r.isSubnetEdge(addr)
+}
+
+func (r ipv4Range) size() int {
+	n := 1
+	for _, o := range r.octets {
+		n *= o.hi - o.lo + 1
+	}
+	if r.subnet <= 30 {
+		// Two edge addresses per subnet
+		n -= 2 * (n >> (32 - r.subnet))
+	}
+	return n
+}
+
+// isSubnetEdge reports whether addr is the network or broadcast address of
+// its subnet
+func (r ipv4Range) isSubnetEdge(addr netip.Addr) bool {
+	if r.subnet > 30 {
+		return false
+	}
+	b := addr.As4()
+	host := (uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])) & (1<<(32-r.subnet) - 1)
+	return host == 0 || host == 1<<(32-r.subnet)-1
+}
@@ -0,0 +1,169 @@
+package network
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// resolved stands in for DNS in tests: scanme.example has two IPv4
+// addresses and one IPv6 address
+var resolved = map[string][]netip.Addr{
+	"scanme.example": {netip.MustParseAddr("10.0.0.5"), netip.MustParseAddr("2001:db8::5"), netip.MustParseAddr("10.0.0.6")},
+}
+
+func TestParseTargets(t *testing.T) {
+	tests := []struct {
+		specs []string
+		opts  TargetOptions
+		want  []string
+	}{
+		{specs: []string{"10.0.0.1"}, want: []string{"10.0.0.1"}},
+		{specs: []string{"10.0.0.1-3"}, want: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{specs: []string{"10.0.0.0/30"}, want: []string{"10.0.0.1", "10.0.0.2"}},
+		{specs: []string{"10.0.1-2.7"}, want: []string{"10.0.1.7", "10.0.2.7"}},
+		{specs: []string{"::1"}, want: []string{"::1"}},
+		{specs: []string{"[2001:db8::]/126"}, want: []string{"2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"}},
+		{specs: []string{"2001:db8::1-2001:db8::2"}, want: []string{"2001:db8::1", "2001:db8::2"}},
+		{specs: []string{"::ffff:10.0.0.1"}, want: []string{"10.0.0.1"}},
+		{
+			specs: []string{"10.0.0.1-5"},
+			opts:  TargetOptions{Exclude: []string{"10.0.0.2", "10.0.0.4-5"}},
+			want:  []string{"10.0.0.1", "10.0.0.3"},
+		},
+		{specs: []string{"scanme.example"}, opts: TargetOptions{Resolved: resolved}, want: []string{"10.0.0.5"}},
+		{specs: []string{"scanme.example"}, opts: TargetOptions{Resolved: resolved, Family: "ip6"}, want: []string{"2001:db8::5"}},
+		{specs: []string{"scanme.example"}, opts: TargetOptions{Resolved: resolved, DualStack: true}, want: []string{"10.0.0.5", "2001:db8::5"}},
+		{
+			specs: []string{"scanme.example"},
+			opts:  TargetOptions{Resolved: resolved, ResolveAll: true, Exclude: []string{"10.0.0.6"}},
+			want:  []string{"10.0.0.5", "2001:db8::5"},
+		},
+	}
+	for _, tt := range tests {
+		ts, err := ParseTargets(context.Background(), tt.specs, tt.opts)
+		if err != nil {
+			t.Errorf("ParseTargets(%q): %v", tt.specs, err)
+			continue
+		}
+		var got []string
+		for target := range ts.All() {
+			got = append(got, target.IP)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParseTargets(%q) = %v, want %v", tt.specs, got, tt.want)
+		}
+		if n := ts.Len(); n != len(tt.want) {
+			t.Errorf("ParseTargets(%q).Len() = %d, want %d", tt.specs, n, len(tt.want))
+		}
+	}
+}
+
+func TestTargetSetLen(t *testing.T) {
+	// Counting must not expand the set
+	ts, err := ParseTargets(context.Background(), []string{"10.0.0.0/8", "192.168.0-255.1"}, TargetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, want := ts.Len(), 1<<24-2+256; n != want {
+		t.Errorf("Len = %d, want %d", n, want)
+	}
+
+	// Nor must it with exclusions, whether they overlap or not
+	tests := []struct {
+		specs   []string
+		exclude []string
+		want    int
+	}{
+		{[]string{"10.0.0.0/8"}, []string{"10.1.2.3"}, 1<<24 - 3},
+		{[]string{"10.0.0.0/8"}, []string{"10.1.2.0/24", "10.1.2.7", "192.168.0.1"}, 1<<24 - 2 - 256},
+		// Subnet edges are not targets, so excluding them changes nothing
+		{[]string{"10.0.0.0/8"}, []string{"10.0.0.0", "10.255.255.255"}, 1<<24 - 2},
+		{[]string{"10.0.0.0/8", "10.0.0.1"}, []string{"10.0.0.1"}, 1<<24 - 3},
+		{[]string{"10.0.0.1-5"}, []string{"10.0.0.0/8"}, 0},
+		{[]string{"2001:db8::/112"}, []string{"2001:db8::1-2001:db8::ff", "2001:db8::/120"}, 1<<16 - 256},
+	}
+	for _, tt := range tests {
+		ts, err := ParseTargets(context.Background(), tt.specs, TargetOptions{Exclude: tt.exclude})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := ts.Len(); n != tt.want {
+			t.Errorf("ParseTargets(%q) excluding %q: Len = %d, want %d", tt.specs, tt.exclude, n, tt.want)
+		}
+	}
+}
+
+func TestParseTargetsErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		opts TargetOptions
+		want string
+	}{
+		{spec: "10.0.0.256", want: "invalid target"},
+		{spec: "10.0.0.5-1", want: "invalid target"},
+		{spec: "10.0.0.0/33", want: "invalid"},
+		{spec: "[::1", want: "missing ]"},
+		{spec: "2001:db8::/64", want: "too large"},
+		{spec: "10.0.0.1", opts: TargetOptions{Family: "ip6"}, want: "only IPv6"},
+		{spec: "::1", opts: TargetOptions{Family: "ip4"}, want: "only IPv4"},
+		{spec: "scanme.example", opts: TargetOptions{Family: "ip6", Resolved: map[string][]netip.Addr{"scanme.example": {netip.MustParseAddr("10.0.0.5")}}}, want: "no IPv6 address"},
+	}
+	for _, tt := range tests {
+		_, err := ParseTargets(context.Background(), []string{tt.spec}, tt.opts)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseTargets(%q) error = %v, want %q", tt.spec, err, tt.want)
+		}
+	}
+}
+
+func TestTargetSetResolved(t *testing.T) {
+	ctx := context.Background()
+	ts, err := ParseTargets(ctx, []string{"localhost"}, TargetOptions{})
+	if err != nil {
+		t.Skipf("localhost does not resolve here: %v", err)
+	}
+	saved := ts.Resolved()
+	if len(saved["localhost"]) == 0 {
+		t.Fatalf("Resolved() = %v, want the addresses of localhost", saved)
+	}
+
+	// Saved addresses are used as they are, whatever DNS answers now
+	saved["localhost"] = []netip.Addr{netip.MustParseAddr("10.9.9.9")}
+	ts, err = ParseTargets(ctx, []string{"localhost"}, TargetOptions{Resolved: saved})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := slices.Collect(ts.All())
+	if len(got) != 1 || got[0] != (Target{IP: "10.9.9.9", Hostname: "localhost"}) {
+		t.Errorf("targets with saved addresses = %v, want [localhost (10.9.9.9)]", got)
+	}
+}
+
+func TestSplitTargets(t *testing.T) {
+	got := SplitTargets("10.0.0.1, example.com\t10.0.1.0/24\n10.0.2.1-9 ::1")
+	want := []string{"10.0.0.1", "example.com", "10.0.1.0/24", "10.0.2.1-9", "::1"}
+	if !slices.Equal(got, want) {
+		t.Errorf("SplitTargets = %q, want %q", got, want)
+	}
+}
+
+func TestReadTargetFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.txt")
+	contents := "# lab hosts\n10.0.0.1, 10.0.0.2 # gateway\n\n10.0.1.0/24\n"
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadTargetFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.0.0.1", "10.0.0.2", "10.0.1.0/24"}; !slices.Equal(got, want) {
+		t.Errorf("ReadTargetFile = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,364 @@
+// Package output renders scan results in machine-readable formats.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"metron_code_jam/pkg/metronet"
+)
+
+// SchemaVersion identifies the layout of the JSON documents written by this
+// package. It is bumped whenever a field is renamed, removed or changes
+// meaning; adding new fields does not change it.
+const SchemaVersion = 1
+
+// Format selects how scan results are written to stdout
+type Format string
+
+const (
+	FormatTable  Format = "table"
+	FormatJSON   Format = "json"
+	FormatNDJSON Format = "ndjson"
+)
+
+// ParseFormat validates an output format name
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case FormatTable, FormatJSON, FormatNDJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q (expected table, json or ndjson)", s)
+	}
+}
+
+// Result is the JSON representation of a metronet.Result
+type Result struct {
+	Host     string `json:"host"`
+	Hostname string `json:"hostname,omitempty"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Service  string `json:"service,omitempty"`
+	Banner   string `json:"banner,omitempty"`
+	Body     string `json:"body,omitempty"`
+	TLS      *TLS   `json:"tls,omitempty"`
+	HTTP     *HTTP  `json:"http,omitempty"`
+
+	Product   string   `json:"product,omitempty"`
+	Version   string   `json:"version,omitempty"`
+	ExtraInfo string   `json:"extra_info,omitempty"`
+	OS        string   `json:"os,omitempty"`
+	CPE       []string `json:"cpe,omitempty"`
+
+	// Timings in milliseconds; latency and first byte are left out when
+	// the port never answered or sent nothing
+	StartedAt   time.Time `json:"started_at"`
+	LatencyMS   float64   `json:"latency_ms,omitempty"`
+	FirstByteMS float64   `json:"first_byte_ms,omitempty"`
+	DurationMS  float64   `json:"duration_ms"`
+}
+
+// TLS is the JSON representation of a metronet.TLSInfo
+type TLS struct {
+	Version      string        `json:"version"`
+	CipherSuite  string        `json:"cipher_suite"`
+	ALPN         string        `json:"alpn,omitempty"`
+	ServerName   string        `json:"server_name,omitempty"`
+	Certificates []Certificate `json:"certificates"`
+}
+
+// HTTP is the JSON representation of a metronet.HTTPInfo
+type HTTP struct {
+	StatusCode      int               `json:"status_code"`
+	Status          string            `json:"status"`
+	Server          string            `json:"server,omitempty"`
+	PoweredBy       string            `json:"powered_by,omitempty"`
+	Location        string            `json:"location,omitempty"`
+	CookieNames     []string          `json:"cookie_names,omitempty"`
+	SecurityHeaders map[string]string `json:"security_headers,omitempty"`
+	Title           string            `json:"title,omitempty"`
+	Redirects       []Redirect        `json:"redirects,omitempty"`
+}
+
+// Redirect is the JSON representation of a metronet.HTTPRedirect
+type Redirect struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Title      string `json:"title,omitempty"`
+}
+
+// Certificate is the JSON representation of a metronet.CertificateInfo
+type Certificate struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SANs               []string  `json:"sans,omitempty"`
+	SerialNumber       string    `json:"serial_number"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	KeyType            string    `json:"key_type"`
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+	SelfSigned         bool      `json:"self_signed"`
+	SHA256             string    `json:"sha256"`
+}
+
+// Statistics is the JSON representation of a metronet.Statistics
+type Statistics struct {
+	Host          string `json:"host,omitempty"` // empty for an interleaved sweep of all hosts
+	Hostname      string `json:"hostname,omitempty"`
+	TotalPorts    int    `json:"total_ports"`
+	OpenPorts     int    `json:"open_ports"`
+	ClosedPorts   int    `json:"closed_ports"`
+	FilteredPorts int    `json:"filtered_ports"`
+	// OpenFilteredPorts counts UDP ports that gave no answer either way
+	OpenFilteredPorts int `json:"open_filtered_ports"`
+	// ErrorPorts counts ports whose state a local failure kept unknown
+	ErrorPorts int `json:"error_ports"`
+	// ProxyErrorPorts counts ports whose state a failing proxy kept unknown
+	ProxyErrorPorts int     `json:"proxy_error_ports,omitempty"`
+	DurationMS      int64   `json:"duration_ms"`
+	Rate            float64 `json:"rate"` // ports scanned per second
+
+	// Latency of the ports that answered, in milliseconds
+	MinLatencyMS float64 `json:"min_latency_ms,omitempty"`
+	AvgLatencyMS float64 `json:"avg_latency_ms,omitempty"`
+	P95LatencyMS float64 `json:"p95_latency_ms,omitempty"`
+	MaxLatencyMS float64 `json:"max_latency_ms,omitempty"`
+}
+
+// HostReport groups the results and statistics of a single host
+type HostReport struct {
+	Host       string     `json:"host"`
+	Hostname   string     `json:"hostname,omitempty"`
+	Results    []Result   `json:"results"`
+	Statistics Statistics `json:"statistics"`
+}
+
+// Report is the document written by the json output format
+type Report struct {
+	SchemaVersion int          `json:"schema_version"`
+	StartedAt     time.Time    `json:"started_at"`
+	FinishedAt    time.Time    `json:"finished_at"`
+	Interrupted   bool         `json:"interrupted,omitempty"`
+	Hosts         []HostReport `json:"hosts"`
+}
+
+// NewResult converts a scan result into its JSON representation
+func NewResult(r metronet.Result) Result {
+	return Result{
+		Host:     r.Host,
+		Hostname: r.Hostname,
+		Port:     r.Port,
+		Protocol: string(r.Protocol),
+		Status:   formatStatus(r.Status),
+		Reason:   string(r.Reason),
+		Error:    errorString(r.Err),
+		Service:  r.Service,
+		Banner:   r.Banner,
+		Body:     r.Body,
+		TLS:      newTLS(r.TLS),
+		HTTP:     newHTTP(r.HTTP),
+
+		Product:   r.Product,
+		Version:   r.Version,
+		ExtraInfo: r.ExtraInfo,
+		OS:        r.OS,
+		CPE:       r.CPE,
+
+		StartedAt:   r.StartedAt.UTC(),
+		LatencyMS:   milliseconds(r.Latency),
+		FirstByteMS: milliseconds(r.FirstByte),
+		DurationMS:  milliseconds(r.Duration),
+	}
+}
+
+// milliseconds converts d to milliseconds, keeping microseconds
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+// newTLS converts TLS handshake details into their JSON representation
+func newTLS(info *metronet.TLSInfo) *TLS {
+	if info == nil {
+		return nil
+	}
+
+	t := &TLS{
+		Version:      info.Version,
+		CipherSuite:  info.CipherSuite,
+		ALPN:         info.ALPN,
+		ServerName:   info.ServerName,
+		Certificates: make([]Certificate, 0, len(info.Certificates)),
+	}
+	for _, cert := range info.Certificates {
+		t.Certificates = append(t.Certificates, Certificate{
+			Subject:            cert.Subject,
+			Issuer:             cert.Issuer,
+			SANs:               cert.SANs,
+			SerialNumber:       cert.SerialNumber,
+			NotBefore:          cert.NotBefore.UTC(),
+			NotAfter:           cert.NotAfter.UTC(),
+			KeyType:            cert.KeyType,
+			SignatureAlgorithm: cert.SignatureAlgorithm,
+			SelfSigned:         cert.SelfSigned,
+			SHA256:             cert.SHA256,
+		})
+	}
+	return t
+}
+
+// newHTTP converts web server details into their JSON representation
+func newHTTP(info *metronet.HTTPInfo) *HTTP {
+	if info == nil {
+		return nil
+	}
+
+	h := &HTTP{
+		StatusCode:      info.StatusCode,
+		Status:          info.Status,
+		Server:          info.Server,
+		PoweredBy:       info.PoweredBy,
+		Location:        info.Location,
+		CookieNames:     info.CookieNames,
+		SecurityHeaders: info.SecurityHeaders,
+		Title:           info.Title,
+	}
+	for _, r := range info.Redirects {
+		h.Redirects = append(h.Redirects, Redirect{URL: r.URL, StatusCode: r.StatusCode, Title: r.Title})
+	}
+	return h
+}
+
+// NewStatistics converts the statistics of one host into their JSON representation
+func NewStatistics(target metronet.Target, stats metronet.Statistics) Statistics {
+	return Statistics{
+		Host:              target.IP,
+		Hostname:          target.Hostname,
+		TotalPorts:        stats.TotalPorts,
+		OpenPorts:         stats.OpenPorts,
+		ClosedPorts:       stats.ClosedPorts,
+		FilteredPorts:     stats.FilteredPorts,
+		OpenFilteredPorts: stats.OpenFilteredPorts,
+		ErrorPorts:        stats.ErrorPorts,
+		ProxyErrorPorts:   stats.ProxyErrorPorts,
+		DurationMS:        stats.ScanDuration.Milliseconds(),
+		Rate:              math.Round(stats.Rate*10) / 10,
+		MinLatencyMS:      milliseconds(stats.MinLatency),
+		AvgLatencyMS:      milliseconds(stats.AvgLatency),
+		P95LatencyMS:      milliseconds(stats.P95Latency),
+		MaxLatencyMS:      milliseconds(stats.MaxLatency),
+	}
+}
+
+// NewReport creates an empty report for a scan started at the given time
+func NewReport(startedAt time.Time) *Report {
+	return &Report{
+		SchemaVersion: SchemaVersion,
+		StartedAt:     startedAt.UTC(),
+		Hosts:         []HostReport{},
+	}
+}
+
+// AddHost appends the results of one host to the report
+func (r *Report) AddHost(target metronet.Target, results []metronet.Result, stats metronet.Statistics) {
+	hr := HostReport{
+		Host:       target.IP,
+		Hostname:   target.Hostname,
+		Results:    make([]Result, 0, len(results)),
+		Statistics: NewStatistics(target, stats),
+	}
+	for _, result := range results {
+		hr.Results = append(hr.Results, NewResult(result))
+	}
+	r.Hosts = append(r.Hosts, hr)
+}
+
+// Write encodes the report as indented JSON
+func (r *Report) Write(w io.Writer, finishedAt time.Time) error {
+	r.FinishedAt = finishedAt.UTC()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Record types written by NDJSONWriter
+const (
+	RecordResult     = "result"
+	RecordStatistics = "statistics"
+)
+
+// resultRecord is a single NDJSON line carrying one port result
+type resultRecord struct {
+	SchemaVersion int    `json:"schema_version"`
+	Type          string `json:"type"`
+	Result
+}
+
+// statisticsRecord is a single NDJSON line carrying the statistics of a host
+type statisticsRecord struct {
+	SchemaVersion int    `json:"schema_version"`
+	Type          string `json:"type"`
+	Statistics
+}
+
+// NDJSONWriter streams results as newline-delimited JSON, one record per line.
+// It is safe for concurrent use.
+type NDJSONWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewNDJSONWriter creates a writer that streams records to w
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{enc: json.NewEncoder(w)}
+}
+
+// WriteResult writes a single port result
+func (n *NDJSONWriter) WriteResult(r metronet.Result) error {
+	return n.write(resultRecord{SchemaVersion: SchemaVersion, Type: RecordResult, Result: NewResult(r)})
+}
+
+// WriteStatistics writes the statistics of a finished host
+func (n *NDJSONWriter) WriteStatistics(target metronet.Target, stats metronet.Statistics) error {
+	return n.write(statisticsRecord{SchemaVersion: SchemaVersion, Type: RecordStatistics, Statistics: NewStatistics(target, stats)})
+}
+
+// Err returns the first error encountered while writing, if any
+func (n *NDJSONWriter) Err() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.err
+}
+
+func (n *NDJSONWriter) write(rec any) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// Stop writing after the first failure (e.g. a closed pipe)
+	if n.err != nil {
+		return n.err
+	}
+	n.err = n.enc.Encode(rec)
+	return n.err
+}
+
+// errorString returns the message of err, or "" when it is nil
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// formatStatus converts a port status into its lowercase JSON form
+func formatStatus(status metronet.Status) string {
+	return strings.ToLower(string(status))
+}
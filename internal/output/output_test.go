@@ -0,0 +1,140 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"metron_code_jam/pkg/metronet"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testTarget is a hostname target, so hostname fields are set
+var testTarget = metronet.Target{IP: "192.0.2.10", Hostname: "scanme.example"}
+
+// testResults and testStatistics cover an open port with every optional
+// field set, a closed one without any, a silent UDP port, a port lost to a
+// local error and a TLS port
+var (
+	testResults = []metronet.Result{
+		{
+			Host: "192.0.2.10", Hostname: "scanme.example", Port: 80, Protocol: metronet.ProtocolTCP,
+			Status: metronet.StatusOpen, Reason: metronet.ReasonSynAck,
+			StartedAt: testStart, Latency: 1234567 * time.Nanosecond, FirstByte: 3500 * time.Microsecond, Duration: 120 * time.Millisecond,
+			Service: "http", Banner: "HTTP/1.1 200 OK\r\nServer: nginx/1.24.0 (Ubuntu)", Body: "It works!",
+			Product: "nginx", Version: "1.24.0", ExtraInfo: "Ubuntu", OS: "Linux",
+			CPE: []string{"cpe:2.3:a:igor_sysoev:nginx:1.24.0:*:*:*:*:*:*:*", "cpe:2.3:o:linux:linux_kernel:*:*:*:*:*:*:*:*"},
+			HTTP: &metronet.HTTPInfo{
+				StatusCode:      200,
+				Status:          "200 OK",
+				Server:          "nginx/1.24.0 (Ubuntu)",
+				CookieNames:     []string{"session"},
+				SecurityHeaders: map[string]string{"Strict-Transport-Security": "max-age=63072000"},
+				Title:           "Welcome",
+				Redirects:       []metronet.HTTPRedirect{{URL: "http://192.0.2.10/", StatusCode: 301, Title: "Moved"}},
+			},
+		},
+		{
+			Host: "192.0.2.10", Hostname: "scanme.example", Port: 443, Protocol: metronet.ProtocolTCP,
+			Status: metronet.StatusClosed, Reason: metronet.ReasonRefused,
+			StartedAt: testStart, Latency: 800 * time.Microsecond, Duration: 800 * time.Microsecond,
+		},
+		{
+			Host: "192.0.2.10", Hostname: "scanme.example", Port: 53, Protocol: metronet.ProtocolUDP,
+			Status: metronet.StatusOpenFiltered, Reason: metronet.ReasonNoResponse,
+			StartedAt: testStart, Duration: time.Second,
+		},
+		{
+			Host: "192.0.2.10", Hostname: "scanme.example", Port: 25, Protocol: metronet.ProtocolTCP,
+			Status: metronet.StatusError, Reason: metronet.ReasonFDExhausted,
+			Err:       errors.New("dial tcp 192.0.2.10:25: socket: too many open files"),
+			StartedAt: testStart,
+		},
+		{
+			Host: "192.0.2.10", Hostname: "scanme.example", Port: 8443, Protocol: metronet.ProtocolTCP,
+			Status: metronet.StatusOpen, Reason: metronet.ReasonSynAck,
+			StartedAt: testStart, Latency: time.Millisecond, Duration: 40 * time.Millisecond,
+			Service: "https-alt",
+			TLS: &metronet.TLSInfo{
+				Version:     "TLS 1.3",
+				CipherSuite: "TLS_AES_128_GCM_SHA256",
+				ALPN:        "h2",
+				ServerName:  "example.com",
+				Certificates: []metronet.CertificateInfo{{
+					Subject:            "CN=example.com",
+					Issuer:             "CN=example.com",
+					SANs:               []string{"example.com", "www.example.com"},
+					SerialNumber:       "1f",
+					NotBefore:          time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+					NotAfter:           time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+					KeyType:            "ECDSA P-256",
+					SignatureAlgorithm: "ECDSA-SHA256",
+					SelfSigned:         true,
+					SHA256:             "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+				}},
+			},
+		},
+	}
+	testStatistics = metronet.Statistics{
+		TotalPorts:        5,
+		OpenPorts:         2,
+		ClosedPorts:       1,
+		OpenFilteredPorts: 1,
+		ErrorPorts:        1,
+		ScanDuration:      1500 * time.Millisecond,
+		Rate:              2.6666,
+		MinLatency:        800 * time.Microsecond,
+		AvgLatency:        1011522 * time.Nanosecond,
+		P95Latency:        1234567 * time.Nanosecond,
+		MaxLatency:        1234567 * time.Nanosecond,
+	}
+	testStart = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// checkGolden compares got with testdata/name, or rewrites it under -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s changed; if the schema change is intended, rerun with -update\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestReport(t *testing.T) {
+	report := NewReport(testStart)
+	report.AddHost(testTarget, testResults, testStatistics)
+
+	var buf bytes.Buffer
+	if err := report.Write(&buf, testStart.Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "report.json", buf.Bytes())
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewNDJSONWriter(&buf)
+	for _, result := range testResults {
+		w.WriteResult(result)
+	}
+	w.WriteStatistics(testTarget, testStatistics)
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "results.ndjson", buf.Bytes())
+}
@@ -0,0 +1,59 @@
+package probes
+
+import (
+	"net/url"
+	"strings"
+)
+
+// cpe23Fields is the number of components after "cpe:2.3:" in a formatted string
+const cpe23Fields = 11
+
+// CPE23 converts a CPE 2.2 URI as written in probe definitions (for example
+// "cpe:/a:openbsd:openssh:8.9p1") into a CPE 2.3 formatted string
+// ("cpe:2.3:a:openbsd:openssh:8.9p1:*:*:*:*:*:*:*"). Strings that are
+// already in 2.3 form are returned unchanged; anything else yields "".
+func CPE23(uri string) string {
+	if strings.HasPrefix(uri, "cpe:2.3:") {
+		return uri
+	}
+	if !strings.HasPrefix(uri, "cpe:/") {
+		return ""
+	}
+
+	components := strings.Split(strings.TrimPrefix(uri, "cpe:/"), ":")
+	if len(components) == 0 || len(components) > 7 || components[0] == "" {
+		return ""
+	}
+
+	fields := make([]string, cpe23Fields)
+	for i := range fields {
+		fields[i] = "*"
+	}
+	for i, component := range components {
+		if component == "" {
+			continue
+		}
+		if decoded, err := url.PathUnescape(component); err == nil {
+			component = decoded
+		}
+		fields[i] = quoteCPE(strings.ToLower(component))
+	}
+
+	return "cpe:2.3:" + strings.Join(fields, ":")
+}
+
+// quoteCPE escapes the characters that must be quoted in a CPE 2.3
+// formatted string component
+func quoteCPE(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
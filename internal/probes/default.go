@@ -0,0 +1,19 @@
+package probes
+
+import (
+	_ "embed"
+	"strings"
+)
+
+//go:embed default-service-probes
+var defaultProbes string
+
+// Default returns a new engine loaded with the built-in probe definitions.
+// Each call parses them again, so callers may extend the result freely.
+func Default() *Engine {
+	e := New()
+	if err := e.Load(strings.NewReader(defaultProbes), "default-service-probes"); err != nil {
+		panic("probes: invalid built-in definitions: " + err.Error())
+	}
+	return e
+}
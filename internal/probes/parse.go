@@ -0,0 +1,382 @@
+package probes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PortRange is an inclusive range of ports
+type PortRange struct {
+	Low, High int
+}
+
+// PortSet is a list of port ranges as written in a ports directive
+type PortSet []PortRange
+
+// Contains reports whether port falls within any range of the set
+func (s PortSet) Contains(port int) bool {
+	for _, r := range s {
+		if port >= r.Low && port <= r.High {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadFile reads probe definitions from a file and adds them to the engine
+func (e *Engine) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return e.Load(f, path)
+}
+
+// Load reads probe definitions in nmap-service-probes syntax and adds them
+// to the engine. Lines with syntax errors abort loading; patterns that only
+// fail to compile are skipped and recorded in Warnings.
+func (e *Engine) Load(r io.Reader, source string) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var current *Probe
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		directive, args, _ := strings.Cut(line, " ")
+		args = strings.TrimSpace(args)
+
+		fail := func(format string, a ...any) error {
+			return fmt.Errorf("%s:%d: %s", source, lineNo, fmt.Sprintf(format, a...))
+		}
+
+		if directive == "Exclude" {
+			if err := e.parseExclude(args); err != nil {
+				return fail("%v", err)
+			}
+			continue
+		}
+
+		if directive == "Probe" {
+			p, err := parseProbe(args)
+			if err != nil {
+				return fail("%v", err)
+			}
+			if current != nil {
+				e.add(current)
+			}
+			current = p
+			continue
+		}
+
+		if current == nil {
+			return fail("%s directive before the first Probe", directive)
+		}
+
+		switch directive {
+		case "match", "softmatch":
+			m, err := parseMatch(args, directive == "softmatch")
+			if err != nil {
+				if _, ok := err.(*patternError); ok {
+					e.Warnings = append(e.Warnings, fmt.Sprintf("%s:%d: %v", source, lineNo, err))
+					continue
+				}
+				return fail("%v", err)
+			}
+			current.Matches = append(current.Matches, m)
+		case "ports":
+			ports, err := parsePortSet(args)
+			if err != nil {
+				return fail("%v", err)
+			}
+			current.Ports = append(current.Ports, ports...)
+		case "sslports":
+			ports, err := parsePortSet(args)
+			if err != nil {
+				return fail("%v", err)
+			}
+			current.SSLPorts = append(current.SSLPorts, ports...)
+		case "rarity":
+			rarity, err := strconv.Atoi(args)
+			if err != nil || rarity < 1 || rarity > 9 {
+				return fail("invalid rarity %q", args)
+			}
+			current.Rarity = rarity
+		case "totalwaitms":
+			ms, err := strconv.Atoi(args)
+			if err != nil || ms < 0 {
+				return fail("invalid totalwaitms %q", args)
+			}
+			current.TotalWait = time.Duration(ms) * time.Millisecond
+		case "fallback":
+			for _, name := range strings.Split(args, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					current.Fallback = append(current.Fallback, name)
+				}
+			}
+		case "tcpwrappedms":
+			// Accepted for compatibility; wrapped services are not detected
+		default:
+			return fail("unknown directive %q", directive)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if current != nil {
+		e.add(current)
+	}
+	return nil
+}
+
+// parseProbe parses the arguments of a Probe line: protocol, name and payload
+func parseProbe(args string) (*Probe, error) {
+	fields := strings.SplitN(args, " ", 3)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("Probe needs a protocol, a name and a q|payload|")
+	}
+
+	protocol := fields[0]
+	if protocol != TCP && protocol != UDP {
+		return nil, fmt.Errorf("unknown probe protocol %q", protocol)
+	}
+
+	rest := strings.TrimSpace(fields[2])
+	if !strings.HasPrefix(rest, "q") || len(rest) < 3 {
+		return nil, fmt.Errorf("probe %s: payload must be written as q|...|", fields[1])
+	}
+	raw, _, err := delimited(rest[1:])
+	if err != nil {
+		return nil, fmt.Errorf("probe %s: %v", fields[1], err)
+	}
+	payload, err := unescape(raw)
+	if err != nil {
+		return nil, fmt.Errorf("probe %s: %v", fields[1], err)
+	}
+
+	return &Probe{
+		Protocol: protocol,
+		Name:     fields[1],
+		Payload:  payload,
+		Rarity:   DefaultRarity,
+	}, nil
+}
+
+// patternError reports a match pattern that Go's regexp package cannot compile
+type patternError struct {
+	service string
+	err     error
+}
+
+func (e *patternError) Error() string {
+	return fmt.Sprintf("skipping %s pattern: %v", e.service, e.err)
+}
+
+// parseMatch parses the arguments of a match or softmatch line:
+//
+//	<service> m|<pattern>|[flags] [p/product/] [v/version/] [i/info/]
+//	          [h/hostname/] [o/os/] [d/devicetype/] [cpe:/cpe/[a]]...
+func parseMatch(args string, soft bool) (*Match, error) {
+	service, rest, ok := strings.Cut(args, " ")
+	if !ok {
+		return nil, fmt.Errorf("match needs a service name and a pattern")
+	}
+	m := &Match{Service: service, Soft: soft}
+
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, "m") || len(rest) < 3 {
+		return nil, fmt.Errorf("match %s: pattern must be written as m|...|", service)
+	}
+	pattern, rest, err := delimited(rest[1:])
+	if err != nil {
+		return nil, fmt.Errorf("match %s: %v", service, err)
+	}
+
+	// Pattern flags follow the closing delimiter directly
+	flags := ""
+	for len(rest) > 0 && rest[0] != ' ' {
+		switch rest[0] {
+		case 'i', 's':
+			flags += string(rest[0])
+		default:
+			return nil, fmt.Errorf("match %s: unknown pattern flag %q", service, rest[0])
+		}
+		rest = rest[1:]
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	m.Pattern, err = regexp.Compile(pattern)
+	if err != nil {
+		return nil, &patternError{service: service, err: err}
+	}
+
+	// Version information templates
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		var field *string
+		key := rest[:1]
+		if strings.HasPrefix(rest, "cpe:") {
+			key, rest = "cpe", rest[3:]
+		}
+		switch key {
+		case "p":
+			field = &m.Product
+		case "v":
+			field = &m.Version
+		case "i":
+			field = &m.Info
+		case "h":
+			field = &m.Hostname
+		case "o":
+			field = &m.OS
+		case "d":
+			field = &m.DeviceType
+		case "cpe":
+		default:
+			return nil, fmt.Errorf("match %s: unknown version field %q", service, key)
+		}
+
+		value, remainder, err := delimited(rest[1:])
+		if err != nil {
+			return nil, fmt.Errorf("match %s: %v", service, err)
+		}
+		rest = remainder
+
+		if key == "cpe" {
+			// The optional "a" flag marks the CPE as an application; it is
+			// implied by the cpe:/a: prefix and needs no handling
+			rest = strings.TrimPrefix(rest, "a")
+			m.CPE = append(m.CPE, "cpe:/"+value)
+			continue
+		}
+		*field = value
+	}
+
+	return m, nil
+}
+
+// delimited splits s, which starts with a delimiter character, into the text
+// up to the matching closing delimiter and everything after it
+func delimited(s string) (string, string, error) {
+	if s == "" {
+		return "", "", fmt.Errorf("missing delimiter")
+	}
+	delim := s[0]
+	end := strings.IndexByte(s[1:], delim)
+	if end < 0 {
+		return "", "", fmt.Errorf("unterminated %c...%c", delim, delim)
+	}
+	return s[1 : end+1], s[end+2:], nil
+}
+
+// unescape decodes the C-style escapes used in probe payloads
+func unescape(s string) ([]byte, error) {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out = append(out, s[i])
+			continue
+		}
+		i++
+		if i >= len(s) {
+			return nil, fmt.Errorf("trailing backslash in payload")
+		}
+		switch s[i] {
+		case '0':
+			out = append(out, 0)
+		case 'a':
+			out = append(out, '\a')
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'v':
+			out = append(out, '\v')
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, fmt.Errorf("incomplete \\x escape in payload")
+			}
+			b, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid \\x escape in payload: %q", s[i-1:i+3])
+			}
+			out = append(out, byte(b))
+			i += 2
+		default:
+			out = append(out, s[i])
+		}
+	}
+	return out, nil
+}
+
+// parsePortSet parses a ports directive such as "21,80-90,8080"
+func parsePortSet(spec string) (PortSet, error) {
+	var set PortSet
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		lowStr, highStr, isRange := strings.Cut(part, "-")
+		low, err := strconv.Atoi(lowStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", part)
+		}
+		high := low
+		if isRange {
+			if high, err = strconv.Atoi(highStr); err != nil {
+				return nil, fmt.Errorf("invalid port range %q", part)
+			}
+		}
+		if low < 0 || high > 65535 || low > high {
+			return nil, fmt.Errorf("invalid port range %q", part)
+		}
+		set = append(set, PortRange{Low: low, High: high})
+	}
+	return set, nil
+}
+
+// parseExclude parses an Exclude directive such as "T:9100-9107,U:161";
+// ports without a protocol prefix are excluded for both protocols
+func (e *Engine) parseExclude(spec string) error {
+	protocols := []string{TCP, UDP}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case strings.HasPrefix(part, "T:"):
+			protocols, part = []string{TCP}, part[2:]
+		case strings.HasPrefix(part, "U:"):
+			protocols, part = []string{UDP}, part[2:]
+		}
+
+		ports, err := parsePortSet(part)
+		if err != nil {
+			return err
+		}
+		for _, protocol := range protocols {
+			e.excluded[protocol] = append(e.excluded[protocol], ports...)
+		}
+	}
+	return nil
+}
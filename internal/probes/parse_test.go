@@ -0,0 +1,136 @@
+package probes
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testProbes = `# comment
+Exclude T:9100-9101,U:161
+Probe TCP NULL q||
+totalwaitms 5000
+match ssh m|^SSH-([\d.]+)-OpenSSH_([\w._-]+)\r?\n| p/OpenSSH/ v/$2/ i/protocol $1/ cpe:/a:openbsd:openssh:$2/a
+softmatch ftp m|^220[- ]|
+
+Probe TCP GetRequest q|GET / HTTP/1.0\r\n\r\n|
+rarity 1
+ports 80-85,8080
+sslports 443
+fallback NULL
+match http m|^HTTP/1\.[01] \d\d\d .*\r\nServer: nginx/([\d.]+)|s p/nginx/ v/$1/
+match broken m|(?<=x)y|
+
+Probe UDP DNSStatusRequest q|\0\0\x10\0\0\0\0\0\0\0\0\0|
+ports 53
+`
+
+func TestLoad(t *testing.T) {
+	e := New()
+	if err := e.Load(strings.NewReader(testProbes), "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	null := e.Probe(TCP, NullProbe)
+	if null == nil || len(null.Payload) != 0 || null.TotalWait != 5*time.Second || len(null.Matches) != 2 {
+		t.Fatalf("NULL probe = %+v", null)
+	}
+	if !null.Matches[1].Soft {
+		t.Error("softmatch parsed as a hard match")
+	}
+
+	get := e.Probe(TCP, "GetRequest")
+	if get == nil {
+		t.Fatal("GetRequest probe missing")
+	}
+	if string(get.Payload) != "GET / HTTP/1.0\r\n\r\n" {
+		t.Errorf("payload = %q", get.Payload)
+	}
+	if get.Rarity != 1 || !get.Ports.Contains(83) || !get.Ports.Contains(8080) || get.Ports.Contains(86) {
+		t.Errorf("GetRequest rarity %d, ports %v", get.Rarity, get.Ports)
+	}
+	if !get.SSLPorts.Contains(443) || !slices.Equal(get.Fallback, []string{NullProbe}) {
+		t.Errorf("GetRequest sslports %v, fallback %v", get.SSLPorts, get.Fallback)
+	}
+	if len(get.Matches) != 1 || len(e.Warnings) != 1 {
+		t.Errorf("got %d matches and warnings %q, want the lookbehind pattern skipped", len(get.Matches), e.Warnings)
+	}
+
+	dns := e.Probe(UDP, "DNSStatusRequest")
+	if dns == nil || len(dns.Payload) != 12 || dns.Payload[2] != 0x10 || dns.Rarity != DefaultRarity {
+		t.Errorf("DNSStatusRequest = %+v", dns)
+	}
+
+	if !e.Excluded(TCP, 9101) || e.Excluded(UDP, 9101) || !e.Excluded(UDP, 161) || e.Excluded(TCP, 161) {
+		t.Error("Exclude directive applied to the wrong protocols")
+	}
+}
+
+func TestLoadMatchTemplates(t *testing.T) {
+	e := New()
+	if err := e.Load(strings.NewReader(testProbes), "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		probe    string
+		response string
+		service  string
+		product  string
+		version  string
+		soft     bool
+	}{
+		{NullProbe, "SSH-2.0-OpenSSH_9.6p1\r\n", "ssh", "OpenSSH", "9.6p1", false},
+		{NullProbe, "220 ready\r\n", "ftp", "", "", true},
+		{"GetRequest", "HTTP/1.1 200 OK\r\nServer: nginx/1.25.3\r\n\r\n", "http", "nginx", "1.25.3", false},
+		// Responses to GetRequest are also tried against the NULL probe's patterns
+		{"GetRequest", "SSH-2.0-OpenSSH_8.0\r\n", "ssh", "OpenSSH", "8.0", false},
+	}
+	for _, tt := range tests {
+		r := e.Match(e.Probe(TCP, tt.probe), []byte(tt.response))
+		if r == nil {
+			t.Errorf("%s %q: no match", tt.probe, tt.response)
+			continue
+		}
+		if r.Service != tt.service || r.Product != tt.product || r.Version != tt.version || r.Soft != tt.soft {
+			t.Errorf("%s %q = %+v", tt.probe, tt.response, r)
+		}
+	}
+
+	r := e.Match(e.Probe(TCP, NullProbe), []byte("SSH-2.0-OpenSSH_9.6p1\r\n"))
+	if r == nil || r.Info != "protocol 2.0" || !slices.Equal(r.CPE, []string{"cpe:/a:openbsd:openssh:9.6p1"}) {
+		t.Errorf("ssh match = %+v", r)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		definitions string
+		want        string
+	}{
+		{"match ssh m|^SSH|", "before the first Probe"},
+		{"Probe SCTP x q||", "unknown probe protocol"},
+		{"Probe TCP x GET", "q|...|"},
+		{"Probe TCP x q|abc", "unterminated"},
+		{"Probe TCP x q|\\x4|", "\\x escape"},
+		{"Probe TCP x q||\nrarity 10", "invalid rarity"},
+		{"Probe TCP x q||\nports 90-80", "invalid port range"},
+		{"Probe TCP x q||\nmatch ssh m|x|z", "unknown pattern flag"},
+		{"Probe TCP x q||\nmatch ssh m|x| q/y/", "unknown version field"},
+		{"Probe TCP x q||\nbogus 1", "unknown directive"},
+	}
+	for _, tt := range tests {
+		err := New().Load(strings.NewReader(tt.definitions), "test")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Load(%q) error = %v, want %q", tt.definitions, err, tt.want)
+		}
+	}
+}
+
+func TestDefaultLoads(t *testing.T) {
+	e := Default()
+	if e.Probe(TCP, NullProbe) == nil || e.Probe(TCP, "GetRequest") == nil {
+		t.Error("built-in definitions lack the NULL or GetRequest probe")
+	}
+}
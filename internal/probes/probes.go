@@ -0,0 +1,319 @@
+// Package probes implements a service detection engine driven by probe
+// definitions in nmap-service-probes syntax. A probe is a payload sent to an
+// open port; its match lines are regular expressions that identify the
+// service in the response and capture version details.
+package probes
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Protocol names used in probe definitions
+const (
+	TCP = "TCP"
+	UDP = "UDP"
+)
+
+// NullProbe is the name of the probe that sends nothing and waits for the
+// service to greet first
+const NullProbe = "NULL"
+
+// DefaultRarity is assigned to probes that do not declare a rarity
+const DefaultRarity = 5
+
+// Probe is a single payload and the patterns that recognise its responses
+type Probe struct {
+	Protocol  string
+	Name      string
+	Payload   []byte
+	Ports     PortSet
+	SSLPorts  PortSet
+	Rarity    int           // 1 (common) to 9 (rare)
+	TotalWait time.Duration // how long to wait for a response, zero for the caller's default
+	Fallback  []string      // probes whose matches are also tried against responses to this one
+	Matches   []*Match
+}
+
+// Match is a pattern that identifies a service, with templates for the
+// version details it captures
+type Match struct {
+	Service    string
+	Pattern    *regexp.Regexp
+	Soft       bool // softmatch: the service is known but the version is not
+	Product    string
+	Version    string
+	Info       string
+	Hostname   string
+	OS         string
+	DeviceType string
+	CPE        []string
+}
+
+// Result is a service identified from a probe response
+type Result struct {
+	Service    string
+	Product    string
+	Version    string
+	Info       string
+	Hostname   string
+	OS         string
+	DeviceType string
+	CPE        []string
+	Probe      string // name of the probe whose response matched
+	Soft       bool
+}
+
+// Engine holds a set of probes and decides which of them to send to a port
+type Engine struct {
+	probes   []*Probe
+	byName   map[string]*Probe
+	excluded map[string]PortSet
+
+	// Intensity (0-9) limits the probes sent to ports they are not
+	// registered for to those with Rarity <= Intensity
+	Intensity int
+
+	// Warnings lists definitions that were skipped while loading, such as
+	// patterns using PCRE features Go regular expressions do not support
+	Warnings []string
+}
+
+// DefaultIntensity sends only the most common probes to unregistered ports
+const DefaultIntensity = 2
+
+// New creates an empty engine
+func New() *Engine {
+	return &Engine{
+		byName:    make(map[string]*Probe),
+		excluded:  make(map[string]PortSet),
+		Intensity: DefaultIntensity,
+	}
+}
+
+// Probe returns the probe with the given protocol and name, or nil
+func (e *Engine) Probe(protocol, name string) *Probe {
+	return e.byName[probeKey(protocol, name)]
+}
+
+// Probes returns all loaded probes in definition order
+func (e *Engine) Probes() []*Probe {
+	return e.probes
+}
+
+// Excluded reports whether the definitions exclude a port from probing
+func (e *Engine) Excluded(protocol string, port int) bool {
+	return e.excluded[protocol].Contains(port)
+}
+
+// ProbesFor returns the probes to send to an open port, in order. Probes
+// registered for the port (via ports, or sslports when the connection is
+// wrapped in TLS) are sent first, ordered by rarity, so client-first services
+// get their request on the first connection. The NULL probe follows unless a
+// registered probe already came first, and then every other probe whose
+// rarity is within the engine's intensity.
+func (e *Engine) ProbesFor(protocol string, port int, tls bool) []*Probe {
+	if e.Excluded(protocol, port) {
+		return nil
+	}
+
+	var registered, others []*Probe
+	var null *Probe
+	for _, p := range e.probes {
+		switch {
+		case p.Protocol != protocol:
+		case p.Name == NullProbe:
+			null = p
+		case p.Ports.Contains(port) || (tls && p.SSLPorts.Contains(port)):
+			registered = append(registered, p)
+		case p.Rarity <= e.Intensity:
+			others = append(others, p)
+		}
+	}
+
+	byRarity := func(list []*Probe) {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Rarity < list[j].Rarity })
+	}
+	byRarity(registered)
+	byRarity(others)
+
+	ordered := make([]*Probe, 0, len(registered)+len(others)+1)
+	if null != nil && len(registered) == 0 {
+		ordered = append(ordered, null)
+	}
+	ordered = append(ordered, registered...)
+	if null != nil && len(registered) > 0 {
+		ordered = append(ordered, null)
+	}
+	return append(ordered, others...)
+}
+
+// Match identifies the service in a response to probe p. The probe's own
+// patterns are tried first, then those of its fallbacks and, for TCP, those
+// of the NULL probe, since many services greet before reading the request.
+// Hard matches win over soft matches; nil means nothing matched.
+func (e *Engine) Match(p *Probe, response []byte) *Result {
+	if len(response) == 0 {
+		return nil
+	}
+
+	subject := latin1(response)
+	var soft *Result
+	for _, candidate := range e.matchOrder(p) {
+		for _, m := range candidate.Matches {
+			groups := m.Pattern.FindStringSubmatch(subject)
+			if groups == nil {
+				continue
+			}
+			r := m.result(groups)
+			r.Probe = p.Name
+			if !m.Soft {
+				return r
+			}
+			if soft == nil {
+				soft = r
+			}
+		}
+	}
+	return soft
+}
+
+// HasService reports whether any of the probe's patterns identify service
+func (p *Probe) HasService(service string) bool {
+	for _, m := range p.Matches {
+		if m.Service == service {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrder lists the probes whose patterns apply to responses to p
+func (e *Engine) matchOrder(p *Probe) []*Probe {
+	order := []*Probe{p}
+	seen := map[*Probe]bool{p: true}
+	add := func(candidate *Probe) {
+		if candidate != nil && !seen[candidate] {
+			seen[candidate] = true
+			order = append(order, candidate)
+		}
+	}
+
+	for _, name := range p.Fallback {
+		add(e.Probe(p.Protocol, name))
+	}
+	if p.Protocol == TCP {
+		add(e.Probe(TCP, NullProbe))
+	}
+	return order
+}
+
+// add registers a probe. A probe with the same protocol and name as an
+// existing one extends it with its matches instead, so additional files can
+// add patterns to the built-in probes.
+func (e *Engine) add(p *Probe) {
+	key := probeKey(p.Protocol, p.Name)
+	if existing, ok := e.byName[key]; ok {
+		existing.Matches = append(existing.Matches, p.Matches...)
+		existing.Ports = append(existing.Ports, p.Ports...)
+		existing.SSLPorts = append(existing.SSLPorts, p.SSLPorts...)
+		existing.Fallback = append(existing.Fallback, p.Fallback...)
+		return
+	}
+	e.byName[key] = p
+	e.probes = append(e.probes, p)
+}
+
+func probeKey(protocol, name string) string {
+	return protocol + "/" + name
+}
+
+// result expands the match templates with the captured groups
+func (m *Match) result(groups []string) *Result {
+	r := &Result{
+		Service:    m.Service,
+		Product:    expand(m.Product, groups),
+		Version:    expand(m.Version, groups),
+		Info:       expand(m.Info, groups),
+		Hostname:   expand(m.Hostname, groups),
+		OS:         expand(m.OS, groups),
+		DeviceType: expand(m.DeviceType, groups),
+		Soft:       m.Soft,
+	}
+	for _, cpe := range m.CPE {
+		if expanded := expand(cpe, groups); expanded != "" {
+			r.CPE = append(r.CPE, expanded)
+		}
+	}
+	return r
+}
+
+// templateFunc matches the helper functions of version templates:
+// $P(n) keeps printable characters, $SUBST(n,"from","to") replaces text and
+// $I(n,">") decodes an integer, which is not supported and expands to nothing
+var templateFunc = regexp.MustCompile(`\$(P|SUBST|I)\((\d)(?:,"([^"]*)"(?:,"([^"]*)")?)?\)`)
+
+// templateGroup matches plain $1 - $9 references
+var templateGroup = regexp.MustCompile(`\$(\d)`)
+
+// expand substitutes capture group references in a template
+func expand(template string, groups []string) string {
+	if template == "" {
+		return ""
+	}
+
+	group := func(ref string) string {
+		n, _ := strconv.Atoi(ref)
+		if n < len(groups) {
+			return groups[n]
+		}
+		return ""
+	}
+
+	out := templateFunc.ReplaceAllStringFunc(template, func(call string) string {
+		parts := templateFunc.FindStringSubmatch(call)
+		value := group(parts[2])
+		switch parts[1] {
+		case "P":
+			return printable(value)
+		case "SUBST":
+			return strings.ReplaceAll(value, parts[3], parts[4])
+		default:
+			return ""
+		}
+	})
+	out = templateGroup.ReplaceAllStringFunc(out, func(ref string) string {
+		return printable(group(ref[1:]))
+	})
+	return strings.TrimSpace(out)
+}
+
+// printable drops non-printable characters from a captured value
+func printable(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 32 && r <= 126 {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// latin1 maps every byte of a response to the rune with the same value, so
+// that patterns such as \xff match raw bytes rather than UTF-8 sequences
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// String describes the probe for diagnostics
+func (p *Probe) String() string {
+	return fmt.Sprintf("%s/%s", p.Protocol, p.Name)
+}
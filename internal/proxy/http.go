@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// httpConnect asks the HTTP proxy p on conn to open a tunnel to address with
+// CONNECT, sending Basic credentials if p has any. Bytes the target sent as
+// soon as the tunnel opened stay readable from the returned connection.
+func httpConnect(conn net.Conn, p *url.URL, address string, last bool) (net.Conn, error) {
+	request := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", address, address)
+	if p.User != nil {
+		password, _ := p.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(p.User.Username() + ":" + password))
+		request += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+	if _, err := conn.Write([]byte(request + "\r\n")); err != nil {
+		return nil, fail(p, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, readError(p, err, last)
+	}
+
+	// The body of the answer is never read: after a 2xx it is the tunnel
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		if reader.Buffered() > 0 {
+			return &bufferedConn{Conn: conn, reader: reader}, nil
+		}
+		return conn, nil
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		return nil, fail(p, fmt.Errorf("%w: %s", ErrAuth, resp.Status))
+	case resp.StatusCode == http.StatusForbidden:
+		return nil, fail(p, fmt.Errorf("%w: %s", ErrDenied, resp.Status))
+	case resp.StatusCode == http.StatusBadGateway, resp.StatusCode == http.StatusServiceUnavailable:
+		return nil, fail(p, fmt.Errorf("%w: %s", ErrGateway, resp.Status))
+	}
+
+	// Proxies answer 504 when the target was silent
+	if last && resp.StatusCode == http.StatusGatewayTimeout {
+		return nil, timeoutError{"http proxy: " + resp.Status}
+	}
+	return nil, fail(p, fmt.Errorf("CONNECT answered %s", resp.Status))
+}
+
+// bufferedConn reads what was buffered along with the proxy's answer before
+// reading from the connection itself
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
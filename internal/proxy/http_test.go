@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// answerConnect plays an HTTP proxy that reads one CONNECT request and
+// answers it with status
+func answerConnect(t *testing.T, status string) net.Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		if _, err := http.ReadRequest(bufio.NewReader(server)); err != nil {
+			return
+		}
+		server.Write([]byte("HTTP/1.1 " + status + "\r\nContent-Length: 0\r\n\r\n"))
+	}()
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestHTTPConnectStatus(t *testing.T) {
+	p, _ := url.Parse("http://127.0.0.1:3128")
+	tests := []struct {
+		status  string
+		last    bool
+		wantErr error // nil for success
+		timeout bool
+	}{
+		{status: "200 Connection established", last: true},
+		{status: "407 Proxy Authentication Required", last: true, wantErr: ErrAuth},
+		{status: "403 Forbidden", last: true, wantErr: ErrDenied},
+		{status: "502 Bad Gateway", last: true, wantErr: ErrGateway},
+		{status: "503 Service Unavailable", last: true, wantErr: ErrGateway},
+		{status: "502 Bad Gateway", last: false, wantErr: ErrGateway},
+		{status: "504 Gateway Timeout", last: true, timeout: true},
+	}
+	for _, tt := range tests {
+		conn, err := httpConnect(answerConnect(t, tt.status), p, "10.0.0.1:22", tt.last)
+		switch {
+		case tt.timeout:
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				t.Errorf("%s: got %v, want a timeout", tt.status, err)
+			}
+		case tt.wantErr == nil:
+			if err != nil || conn == nil {
+				t.Errorf("%s: got %v, want a tunnel", tt.status, err)
+			}
+		default:
+			var proxyErr *Error
+			if !errors.As(err, &proxyErr) || !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: got %v, want a proxy error wrapping %v", tt.status, err, tt.wantErr)
+				continue
+			}
+			if !strings.Contains(err.Error(), tt.status) {
+				t.Errorf("%s: error %q lacks the status line", tt.status, err)
+			}
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				t.Errorf("%s: reported as a refused connection", tt.status)
+			}
+		}
+	}
+}
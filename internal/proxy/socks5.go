@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"syscall"
+)
+
+// SOCKS5 authentication methods
+const (
+	socksNoAuth       = 0x00
+	socksUserPass     = 0x02
+	socksNoAcceptable = 0xff
+)
+
+// socksReplies names the failure codes of a SOCKS5 connect reply
+var socksReplies = map[byte]string{
+	0x01: "general failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// socks5Connect asks the SOCKS5 proxy p on conn to connect to address
+// (RFC 1928), logging in with the user name and password of p if it has
+// any (RFC 1929)
+func socks5Connect(conn net.Conn, p *url.URL, address string, last bool) error {
+	methods := []byte{socksNoAuth}
+	if p.User != nil {
+		methods = []byte{socksNoAuth, socksUserPass}
+	}
+	greeting := append([]byte{0x05, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return fail(p, err)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fail(p, err)
+	}
+	if reply[0] != 0x05 {
+		return fail(p, fmt.Errorf("not a SOCKS5 server"))
+	}
+	switch reply[1] {
+	case socksNoAuth:
+	case socksUserPass:
+		if p.User == nil {
+			return fail(p, fmt.Errorf("%w: the proxy asks for a user name and password", ErrAuth))
+		}
+		if err := socks5Login(conn, p); err != nil {
+			return err
+		}
+	case socksNoAcceptable:
+		return fail(p, fmt.Errorf("%w: no acceptable authentication method", ErrAuth))
+	default:
+		return fail(p, fmt.Errorf("unsupported authentication method %d", reply[1]))
+	}
+
+	request, err := socks5Request(address)
+	if err != nil {
+		return fail(p, err)
+	}
+	if _, err := conn.Write(request); err != nil {
+		return fail(p, err)
+	}
+
+	// Version, reply code, reserved byte and the type of the bound address
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return readError(p, err, last)
+	}
+	if header[1] != 0x00 {
+		return socks5ReplyError(p, header[1], last)
+	}
+	var bound int
+	switch header[3] {
+	case 0x01:
+		bound = net.IPv4len
+	case 0x04:
+		bound = net.IPv6len
+	case 0x03:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return fail(p, err)
+		}
+		bound = int(length[0])
+	default:
+		return fail(p, fmt.Errorf("invalid bound address type %d", header[3]))
+	}
+	if _, err := io.ReadFull(conn, make([]byte, bound+2)); err != nil {
+		return fail(p, err)
+	}
+	return nil
+}
+
+// socks5Login sends the user name and password of p
+func socks5Login(conn net.Conn, p *url.URL) error {
+	user := p.User.Username()
+	password, _ := p.User.Password()
+	if len(user) > 255 || len(password) > 255 {
+		return fail(p, fmt.Errorf("user name and password are limited to 255 bytes"))
+	}
+	login := []byte{0x01, byte(len(user))}
+	login = append(login, user...)
+	login = append(login, byte(len(password)))
+	login = append(login, password...)
+	if _, err := conn.Write(login); err != nil {
+		return fail(p, err)
+	}
+	status := make([]byte, 2)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		return fail(p, err)
+	}
+	if status[1] != 0x00 {
+		return fail(p, fmt.Errorf("%w: user name or password rejected", ErrAuth))
+	}
+	return nil
+}
+
+// socks5Request builds the CONNECT request for address. IP literals are sent
+// as addresses and anything else as a name for the proxy to resolve.
+func socks5Request(address string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %q", address)
+	}
+
+	request := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("host name too long: %s", host)
+		}
+		request = append(request, 0x03, byte(len(host)))
+		request = append(request, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		request = append(request, 0x01)
+		request = append(request, ip4...)
+	} else {
+		request = append(request, 0x04)
+		request = append(request, ip.To16()...)
+	}
+	return append(request, byte(port>>8), byte(port)), nil
+}
+
+// socks5ReplyError turns the failure code of a connect reply into an error.
+// Codes about the target, from the last proxy, map to the errors a direct
+// dial would have returned; anything else is a failure of the proxy.
+func socks5ReplyError(p *url.URL, code byte, last bool) error {
+	name, ok := socksReplies[code]
+	if !ok {
+		name = "unknown error"
+	}
+	if last {
+		switch code {
+		case 0x03:
+			return fmt.Errorf("socks5 proxy: %w", syscall.ENETUNREACH)
+		case 0x04:
+			return fmt.Errorf("socks5 proxy: %w", syscall.EHOSTUNREACH)
+		case 0x05:
+			return fmt.Errorf("socks5 proxy: %w", syscall.ECONNREFUSED)
+		case 0x06:
+			return timeoutError{"socks5 proxy: TTL expired"}
+		}
+	}
+	if code == 0x02 {
+		return fail(p, ErrDenied)
+	}
+	return fail(p, errors.New(name))
+}
@@ -1,138 +1,190 @@
 package scanner
 
 import (
-	"bufio"
-	"fmt"
+	"context"
 	"net"
-	"strings"
+	"sync"
 	"time"
+
+	"metron_code_jam/internal/probes"
 )
 
-// ServiceSignatures maps common port numbers to service names
+// ServiceSignatures maps common port numbers to service names. It is only
+// consulted when no probe identified the service.
 var ServiceSignatures = map[int]string{
-	21:    "FTP",
-	22:    "SSH",
-	23:    "Telnet",
-	25:    "SMTP",
-	53:    "DNS",
-	80:    "HTTP",
-	110:   "POP3",
-	143:   "IMAP",
-	443:   "HTTPS",
-	445:   "SMB",
-	3306:  "MySQL",
-	3389:  "RDP",
-	5432:  "PostgreSQL",
-	5900:  "VNC",
-	6379:  "Redis",
-	8080:  "HTTP-Proxy",
-	8443:  "HTTPS-Alt",
-	9200:  "Elasticsearch",
-	27017: "MongoDB",
+	21:    "ftp",
+	22:    "ssh",
+	23:    "telnet",
+	25:    "smtp",
+	53:    "domain",
+	80:    "http",
+	110:   "pop3",
+	143:   "imap",
+	443:   "https",
+	445:   "microsoft-ds",
+	3306:  "mysql",
+	3389:  "ms-wbt-server",
+	5432:  "postgresql",
+	5900:  "vnc",
+	6379:  "redis",
+	8080:  "http-proxy",
+	8443:  "https-alt",
+	9200:  "elasticsearch",
+	27017: "mongodb",
 }
 
-// GrabBanner attempts to grab a banner from an open port
-func GrabBanner(host string, port int, timeout time.Duration) (string, error) {
-	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
-	conn, err := net.DialTimeout("tcp", address, timeout)
-	if err != nil {
-		return "", err
-	}
-	defer conn.Close()
+// maxResponseSize bounds how much of a probe response is read
+const maxResponseSize = 16384
 
-	// Set read deadline
-	conn.SetReadDeadline(time.Now().Add(timeout))
+// responseIdleTimeout is how long to keep reading once a response has started
+const responseIdleTimeout = 250 * time.Millisecond
 
-	// For some services, we need to send a request first
-	if needsRequest(port) {
-		if err := sendInitialRequest(conn, port); err != nil {
-			return "", err
-		}
-	}
+var (
+	defaultProbesOnce sync.Once
+	defaultProbes     *probes.Engine
+)
 
-	// Read banner
-	reader := bufio.NewReader(conn)
-	banner := make([]byte, 1024)
-	n, err := reader.Read(banner)
-	if err != nil && n == 0 {
-		return "", err
-	}
-	// fmt.Println("banner: ",string(banner[:n]))
-	return string(banner[:n]), nil
+// DefaultProbes returns the shared engine loaded with the built-in probe
+// definitions. It must not be modified; use probes.Default to get a copy
+// that can be extended.
+func DefaultProbes() *probes.Engine {
+	defaultProbesOnce.Do(func() {
+		defaultProbes = probes.Default()
+	})
+	return defaultProbes
 }
 
-// IdentifyService attempts to identify the service based on port and banner
-func IdentifyService(port int, banner string) string {
-	// First check known port signatures
-	if service, ok := ServiceSignatures[port]; ok {
-		// If we have a banner, try to get more specific info
-		if banner != "" {
-			detected := detectServiceFromBanner(banner)
-			if detected != "" {
-				return fmt.Sprintf("%s (%s)", service, detected)
+// serviceProbe holds what the probe engine learned about an open port
+type serviceProbe struct {
+	banner    string         // first non-empty response
+	firstByte time.Duration  // from sending the probe that drew banner to its first byte
+	match     *probes.Result // nil if no probe matched
+}
+
+// probeSession describes how to probe the service on one open TCP port
+type probeSession struct {
+	engine   *probes.Engine
+	redial   func() (net.Conn, error) // opens a fresh connection, in TLS if tls is set
+	opts     ProbeOptions             // how to reach the port again
+	port     int
+	tls      bool
+	httpHost string // Host header added to HTTP request probes
+	timeout  time.Duration
+}
+
+// probeService sends the engine's probes for the port until one of them
+// identifies the service. conn, if not nil, carries the first probe; every
+// further probe gets a fresh connection from redial, since a service that
+// received one payload cannot be expected to parse another.
+func (ps *probeSession) probeService(ctx context.Context, conn net.Conn) serviceProbe {
+	var result serviceProbe
+	var soft *probes.Result
+
+	for _, p := range ps.engine.ProbesFor(probes.TCP, ps.port, ps.tls) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Once a softmatch named the service, only probes that can refine it are useful
+		if soft != nil && !p.HasService(soft.Service) {
+			continue
+		}
+
+		if conn == nil {
+			var err error
+			if conn, err = ps.redial(); err != nil {
+				break
 			}
 		}
-		return service
-	}
+		payload := withHostHeader(p.Payload, ps.httpHost)
+		response, firstByte := exchange(conn, payload, probeWait(p, ps.timeout))
+		conn.Close()
+		conn = nil
+
+		if result.banner == "" && len(response) > 0 {
+			result.banner, result.firstByte = string(response), firstByte
+		}
 
-	// Try to detect from banner if port is unknown
-	if banner != "" {
-		if detected := detectServiceFromBanner(banner); detected != "" {
-			return detected
+		match := ps.engine.Match(p, response)
+		if match == nil {
+			continue
+		}
+		if !match.Soft {
+			result.match = match
+			return result
+		}
+		if soft == nil {
+			soft = match
 		}
 	}
 
-	return "Unknown"
+	if conn != nil {
+		conn.Close()
+	}
+	result.match = soft
+	return result
 }
 
-// detectServiceFromBanner analyzes banner content to identify service
-func detectServiceFromBanner(banner string) string {
-	bannerLower := strings.ToLower(banner)
-
-	signatures := map[string]string{
-		"ssh-":       "SSH",
-		"http/":      "HTTP",
-		"ftp":        "FTP",
-		"smtp":       "SMTP",
-		"pop3":       "POP3",
-		"imap":       "IMAP",
-		"mysql":      "MySQL",
-		"postgresql": "PostgreSQL",
-		"redis":      "Redis",
-		"mongodb":    "MongoDB",
-		"nginx":      "nginx",
-		"apache":     "Apache",
-		"microsoft":  "Microsoft",
+// exchange sends payload, if any, and reads the response. It waits up to wait
+// for the first bytes and then keeps reading while more data arrives quickly.
+// It also returns how long the first byte took to arrive after the payload
+// was sent.
+func exchange(conn net.Conn, payload []byte, wait time.Duration) ([]byte, time.Duration) {
+	sent := time.Now()
+	conn.SetDeadline(sent.Add(wait))
+	if len(payload) > 0 {
+		if _, err := conn.Write(payload); err != nil {
+			return nil, 0
+		}
 	}
 
-	for sig, service := range signatures {
-		if strings.Contains(bannerLower, sig) {
-			return service
+	var firstByte time.Duration
+	response := make([]byte, 0, 1024)
+	buf := make([]byte, 1024)
+	for len(response) < maxResponseSize {
+		n, err := conn.Read(buf)
+		if n > 0 && firstByte == 0 {
+			firstByte = time.Since(sent)
+		}
+		response = append(response, buf[:n]...)
+		if err != nil {
+			break
 		}
+		conn.SetReadDeadline(time.Now().Add(responseIdleTimeout))
 	}
-
-	return ""
+	if len(response) > maxResponseSize {
+		response = response[:maxResponseSize]
+	}
+	return response, firstByte
 }
 
-// needsRequest returns true if the service requires an initial request
-func needsRequest(port int) bool {
-	// HTTP-like services need a request
-	return port == 80 || port == 443 || port == 8080 || port == 8443
+// probeWait returns how long to wait for a response to p
+func probeWait(p *probes.Probe, timeout time.Duration) time.Duration {
+	if p.TotalWait > 0 && p.TotalWait < timeout {
+		return p.TotalWait
+	}
+	return timeout
 }
 
-// sendInitialRequest sends an initial request to services that need it
-func sendInitialRequest(conn net.Conn, port int) error {
-	var request string
-
-	switch port {
-	case 80, 8080:
-		request = "GET / HTTP/1.0\r\n\r\n"
-	case 443, 8443:
-		request = "GET / HTTP/1.0\r\n\r\n"
-	default:
-		return nil
+// serviceForPort returns the service commonly found on a TCP port
+func serviceForPort(port int) string {
+	if service, ok := ServiceSignatures[port]; ok {
+		return service
 	}
+	return "unknown"
+}
 
-	_, err := conn.Write([]byte(request))
-	return err
+// applyMatch records the service and version details identified by a probe
+func (r *ScanResult) applyMatch(match *probes.Result) {
+	r.Service = match.Service
+	r.Product = match.Product
+	r.Version = match.Version
+	r.ExtraInfo = match.Info
+	r.OS = match.OS
+	r.CPE = nil
+	for _, uri := range match.CPE {
+		if cpe := probes.CPE23(uri); cpe != "" {
+			r.CPE = append(r.CPE, cpe)
+		}
+	}
 }
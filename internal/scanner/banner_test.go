@@ -0,0 +1,52 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestProbeService(t *testing.T) {
+	tests := []struct {
+		name    string
+		port    int
+		service string
+		product string
+		soft    bool
+		banner  string
+		dials   int
+	}{
+		// The greeting matches the NULL probe on the first connection
+		{"banner", 22, "ssh", "OpenSSH", false, "SSH-2.0-OpenSSH_9.6\r\n", 1},
+		// A silent service falls through to the next probe, on a new connection
+		{"silent", 8000, "http", "Example", false, "HTTP/1.0 200 OK\r\nServer: Example\r\n\r\n", 2},
+		// A softmatch skips GetRequest, which cannot refine ftp, and Help does
+		{"softmatch", 2121, "ftp", "ExampleFTP", false, "220 ready\r\n", 2},
+		// Nothing matches, but the first response is kept
+		{"unknown", 9999, "", "", false, "hello\r\n", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := testNetwork(t)
+			opts := ProbeOptions{Timeout: 200 * time.Millisecond, Dialer: n}
+			ctx := context.Background()
+			session := newProbeSession(ctx, testEngine(t), "10.0.0.1", tt.port, false, opts)
+
+			probed := session.probeService(ctx, nil)
+			if probed.banner != tt.banner {
+				t.Errorf("banner = %q, want %q", probed.banner, tt.banner)
+			}
+			if tt.service == "" {
+				if probed.match != nil {
+					t.Errorf("match = %+v, want none", probed.match)
+				}
+			} else if probed.match == nil || probed.match.Service != tt.service || probed.match.Product != tt.product || probed.match.Soft != tt.soft {
+				t.Errorf("match = %+v, want %s %s", probed.match, tt.service, tt.product)
+			}
+			if dials := n.Dials("tcp", fmt.Sprintf("10.0.0.1:%d", tt.port)); dials != tt.dials {
+				t.Errorf("port dialed %d times, want %d", dials, tt.dials)
+			}
+		})
+	}
+}
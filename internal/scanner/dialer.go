@@ -0,0 +1,105 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Dialer opens the connections of a scan; *net.Dialer is one. Embedders
+// can supply their own transport, and tests an in-memory network.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Source controls where outgoing probes leave from. The zero value lets the
+// system choose.
+type Source struct {
+	IP        net.IP // local address to send from
+	Port      int    // local port of the connection that checks a port; ephemeral when zero
+	Interface string // network interface to send through; Linux only
+}
+
+// Validate checks that the source can be used on this machine
+func (s Source) Validate() error {
+	if s.Port < 0 || s.Port > 65535 {
+		return fmt.Errorf("source port %d out of range (0-65535)", s.Port)
+	}
+	if s.Interface != "" {
+		if !canBindToDevice {
+			return fmt.Errorf("binding to an interface is only supported on Linux")
+		}
+		if _, err := net.InterfaceByName(s.Interface); err != nil {
+			return fmt.Errorf("unknown interface %s", s.Interface)
+		}
+	}
+	if s.IP != nil && !isLocalAddress(s.IP) {
+		return fmt.Errorf("%s is not an address of this machine", s.IP)
+	}
+	return nil
+}
+
+// isZero reports whether the source is left to the system
+func (s Source) isZero() bool {
+	return s.IP == nil && s.Port == 0 && s.Interface == ""
+}
+
+// isLocalAddress reports whether ip is assigned to one of the interfaces
+func isLocalAddress(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if prefix, ok := addr.(*net.IPNet); ok && prefix.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialer returns a net.Dialer bound to the source for network. The source
+// port is left out of follow-up connections to a service, since the
+// previous connection from that port to the same service is still in
+// TIME_WAIT.
+func (s Source) dialer(network string, withPort bool) *net.Dialer {
+	port := 0
+	if withPort {
+		port = s.Port
+	}
+
+	dialer := &net.Dialer{}
+	if s.IP != nil || port != 0 {
+		switch network {
+		case "udp", "udp4", "udp6":
+			dialer.LocalAddr = &net.UDPAddr{IP: s.IP, Port: port}
+		default:
+			dialer.LocalAddr = &net.TCPAddr{IP: s.IP, Port: port}
+		}
+	}
+	if s.Interface != "" || port != 0 {
+		dialer.Control = s.control(port != 0)
+	}
+	return dialer
+}
+
+// dial opens a connection to address for a probe, with the Dialer or else
+// from the source, and through the proxy chain if there is one. withPort
+// binds the source port; see Source.dialer.
+func (o ProbeOptions) dial(ctx context.Context, network, address string, timeout time.Duration, withPort bool) (net.Conn, error) {
+	var dialer Dialer = o.Dialer
+	if dialer == nil {
+		dialer = o.Source.dialer(network, withPort)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if o.Proxy == nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	// The dialer only reaches the first proxy
+	chain := *o.Proxy
+	chain.Forward = dialer
+	return chain.DialContext(ctx, network, address)
+}
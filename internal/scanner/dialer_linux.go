@@ -0,0 +1,38 @@
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+const canBindToDevice = true
+
+// canShareSourcePort tells whether concurrent connections may leave from
+// the same source port, each to a different target port
+const canShareSourcePort = true
+
+// control returns the function that prepares a socket before it is bound:
+// it ties the socket to the source interface with SO_BINDTODEVICE, and with
+// reuse set lets many sockets share the source port
+func (s Source) control(reuse bool) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			if s.Interface != "" {
+				if err := syscall.BindToDevice(int(fd), s.Interface); err != nil {
+					sockErr = os.NewSyscallError("setsockopt", err)
+					return
+				}
+			}
+			if reuse {
+				if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+					sockErr = os.NewSyscallError("setsockopt", err)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
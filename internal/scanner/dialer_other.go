@@ -0,0 +1,18 @@
+//go:build !unix
+
+package scanner
+
+import "syscall"
+
+const canBindToDevice = false
+
+// canShareSourcePort tells whether concurrent connections may leave from
+// the same source port
+const canShareSourcePort = false
+
+// control returns the function that prepares a socket before it is bound.
+// Interfaces cannot be selected outside Linux, and sockets do not share the
+// source port, so only one connection may use it at a time.
+func (s Source) control(reuse bool) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,37 @@
+//go:build unix && !linux
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+const canBindToDevice = false
+
+// canShareSourcePort tells whether concurrent connections may leave from
+// the same source port. BSD kernels refuse to bind a port another live
+// socket holds, so they may not.
+const canShareSourcePort = false
+
+// control returns the function that prepares a socket before it is bound.
+// Interfaces cannot be selected outside Linux. With reuse set, the source
+// port may be bound again while an earlier connection from it is in
+// TIME_WAIT.
+func (s Source) control(reuse bool) func(network, address string, c syscall.RawConn) error {
+	if !reuse {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+				sockErr = os.NewSyscallError("setsockopt", err)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
@@ -0,0 +1,203 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HTTPInfo describes the response of a web server to a request for "/"
+type HTTPInfo struct {
+	StatusCode      int
+	Status          string // status line text, e.g. "200 OK"
+	Server          string
+	PoweredBy       string
+	Location        string // redirect target, if any
+	CookieNames     []string
+	SecurityHeaders map[string]string // security headers present in the response
+	Title           string
+	Redirects       []HTTPRedirect // chain followed within the same host, if enabled
+}
+
+// HTTPRedirect is one step of a redirect chain
+type HTTPRedirect struct {
+	URL        string
+	StatusCode int
+	Title      string
+}
+
+// securityHeaders lists response headers that harden browsers against attacks
+var securityHeaders = []string{
+	"Strict-Transport-Security",
+	"Content-Security-Policy",
+	"X-Frame-Options",
+	"X-Content-Type-Options",
+	"Referrer-Policy",
+	"Permissions-Policy",
+	"Cross-Origin-Opener-Policy",
+	"Cross-Origin-Resource-Policy",
+	"Cross-Origin-Embedder-Policy",
+}
+
+// maxTitleLength bounds the recorded page title
+const maxTitleLength = 200
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// parseHTTPResponse parses a raw response captured by a probe. It returns
+// false if the response is not HTTP. The body may be truncated, since probes
+// only read the start of a response.
+func parseHTTPResponse(raw []byte) (*HTTPInfo, string, bool) {
+	if !bytes.HasPrefix(raw, []byte("HTTP/1.")) {
+		return nil, "", false
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+	if err != nil {
+		return nil, "", false
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	info := &HTTPInfo{
+		StatusCode: resp.StatusCode,
+		Status:     strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+		Server:     resp.Header.Get("Server"),
+		PoweredBy:  resp.Header.Get("X-Powered-By"),
+		Location:   resp.Header.Get("Location"),
+		Title:      extractTitle(body),
+	}
+	info.Status = fmt.Sprintf("%d %s", resp.StatusCode, info.Status)
+
+	for _, cookie := range resp.Cookies() {
+		info.CookieNames = append(info.CookieNames, cookie.Name)
+	}
+	sort.Strings(info.CookieNames)
+
+	for _, name := range securityHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			if info.SecurityHeaders == nil {
+				info.SecurityHeaders = make(map[string]string)
+			}
+			info.SecurityHeaders[name] = value
+		}
+	}
+
+	// Keep the content of <body> for HTML pages and the raw body otherwise
+	text := string(body)
+	if inner := GetBody(text); inner != "" {
+		text = inner
+	}
+	return info, strings.TrimSpace(text), true
+}
+
+// extractTitle returns the text of the first <title> element of an HTML page
+func extractTitle(body []byte) string {
+	m := titlePattern.FindSubmatch(body)
+	if m == nil {
+		return ""
+	}
+	title := strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+	if len(title) > maxTitleLength {
+		title = title[:maxTitleLength] + "..."
+	}
+	return title
+}
+
+// followRedirects follows the Location headers of info for up to maxHops
+// requests, as long as they stay on the same host name, and records the chain
+func (ps *probeSession) followRedirects(ctx context.Context, info *HTTPInfo, host string, maxHops int) {
+	scheme := "http"
+	if ps.tls {
+		scheme = "https"
+	}
+	current := &url.URL{Scheme: scheme, Host: ps.httpHost, Path: "/"}
+	status, location := info.StatusCode, info.Location
+
+	for hop := 0; hop < maxHops && ctx.Err() == nil; hop++ {
+		if status < 300 || status > 399 {
+			return
+		}
+		next, err := current.Parse(location)
+		if err != nil || location == "" || !strings.EqualFold(next.Hostname(), current.Hostname()) {
+			return
+		}
+
+		useTLS := next.Scheme == "https"
+		if !useTLS && next.Scheme != "http" {
+			return
+		}
+		port := 80
+		if useTLS {
+			port = 443
+		}
+		if p := next.Port(); p != "" {
+			if port, err = strconv.Atoi(p); err != nil {
+				return
+			}
+		}
+
+		conn, err := redialer(ctx, ps.opts, host, next.Hostname(), port, useTLS)()
+		if err != nil {
+			return
+		}
+		request := fmt.Sprintf("GET %s HTTP/1.0\r\nHost: %s\r\n\r\n", next.RequestURI(), next.Host)
+		raw, _ := exchange(conn, []byte(request), ps.timeout)
+		conn.Close()
+
+		hopInfo, _, ok := parseHTTPResponse(raw)
+		if !ok {
+			return
+		}
+		info.Redirects = append(info.Redirects, HTTPRedirect{
+			URL:        next.String(),
+			StatusCode: hopInfo.StatusCode,
+			Title:      hopInfo.Title,
+		})
+
+		current, status, location = next, hopInfo.StatusCode, hopInfo.Location
+	}
+}
+
+// withHostHeader adds a Host header to HTTP request payloads that lack one,
+// so that virtual hosts answer for the scanned name rather than a default site
+func withHostHeader(payload []byte, host string) []byte {
+	if host == "" {
+		return payload
+	}
+
+	lineEnd := bytes.Index(payload, []byte("\r\n"))
+	if lineEnd < 0 || !bytes.Contains(payload[:lineEnd], []byte(" HTTP/1.")) {
+		return payload
+	}
+	if bytes.Contains(bytes.ToLower(payload), []byte("\r\nhost:")) {
+		return payload
+	}
+
+	out := make([]byte, 0, len(payload)+len(host)+8)
+	out = append(out, payload[:lineEnd+2]...)
+	out = append(out, "Host: "+host+"\r\n"...)
+	return append(out, payload[lineEnd+2:]...)
+}
+
+// hostHeader returns the Host header value for a target, leaving out the
+// port when it is the default for the scheme
+func hostHeader(host string, port int, useTLS bool) string {
+	if (port == 80 && !useTLS) || (port == 443 && useTLS) {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
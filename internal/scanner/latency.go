@@ -0,0 +1,48 @@
+package scanner
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+// latencySteps is the number of histogram buckets per doubling of latency,
+// which keeps percentiles within about 4% of the measured values
+const latencySteps = 16
+
+// latencyHistogram summarises latencies in logarithmic buckets, so that
+// percentiles over any number of ports take constant memory
+type latencyHistogram struct {
+	buckets  map[int]int
+	count    int
+	sum      time.Duration
+	min, max time.Duration
+}
+
+func (h *latencyHistogram) add(d time.Duration) {
+	if h.buckets == nil {
+		h.buckets = make(map[int]int)
+		h.min = d
+	}
+	h.buckets[int(math.Log2(float64(max(d, 1)))*latencySteps)]++
+	h.count++
+	h.sum += d
+	h.min = min(h.min, d)
+	h.max = max(h.max, d)
+}
+
+// percentile returns the latency that p (0 to 1) of the samples did not exceed
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(h.count)))
+	seen := 0
+	for _, b := range slices.Sorted(maps.Keys(h.buckets)) {
+		seen += h.buckets[b]
+		if seen >= rank {
+			// Upper edge of the bucket, within the range actually seen
+			d := time.Duration(math.Exp2(float64(b+1) / latencySteps))
+			return min(max(d, h.min), h.max)
+		}
+	}
+	return h.max
+}
@@ -1,50 +1,150 @@
 package scanner
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"syscall"
 	"time"
+
+	"metron_code_jam/internal/probes"
 )
 
 // ScanPort scans a single port and returns the result
-func ScanPort(host string, port int, timeout time.Duration) ScanResult {
-	result := ScanResult{
-		Host:   host,
-		Port:   port,
-		Status: StatusClosed,
+func ScanPort(ctx context.Context, host string, port int, opts ProbeOptions) ScanResult {
+	result, _ := scanPort(ctx, host, port, opts)
+	return result
+}
+
+// scanPort scans a single port. The connection that proves the port open is
+// reused for banner grabbing, so each port is dialed at most once. It returns
+// ctx.Err() when the scan was interrupted before the port state could be
+// determined.
+func scanPort(ctx context.Context, host string, port int, opts ProbeOptions) (result ScanResult, err error) {
+	result = ScanResult{
+		Host:      host,
+		Hostname:  opts.Hostname,
+		Port:      port,
+		Protocol:  ProtocolTCP,
+		Status:    StatusClosed,
+		StartedAt: time.Now(),
 	}
+	defer func() {
+		result.Duration = time.Since(result.StartedAt)
+	}()
 
 	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
-	fmt.Printf("Start scanning port %d\n", port)
-	conn, err := net.DialTimeout("tcp", address, timeout)
+	start := time.Now()
+	conn, err := opts.dial(ctx, "tcp", address, opts.connectTimeout(), true)
+
+	// A completed handshake or a reset both took one round trip
+	if err == nil || errors.Is(err, syscall.ECONNREFUSED) {
+		result.Latency = time.Since(start)
+		opts.rtt.sample(result.Latency)
+	}
 
 	if err != nil {
-		// Determine if port is filtered or closed
-		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			result.Status = StatusFiltered
-		} else {
-			result.Status = StatusClosed
+		if ctx.Err() != nil {
+			return result, ctx.Err()
 		}
-		fmt.Printf("End scanning port %d\n with error: %v", port, err)
-		return result
+		result.Status, result.Reason = classifyError(err)
+		result.Err = err
+		return result, nil
 	}
 	defer conn.Close()
 
 	// Port is open
-	result.Status = StatusOpen
-
-	// Attempt banner grabbing
-	banner, err := GrabBanner(host, port, timeout)
-	// fmt.Printf("banner %T: ",banner)
-	if err == nil && banner != "" {
-		result.Banner = cleanBanner(banner)
-		result.Service = IdentifyService(port, banner)
-		result.Body = GetBody(banner)
-	} else {
-		result.Service = IdentifyService(port, "")
-	}
-	fmt.Printf("End scanning port %d\n", port)
-	return result
+	result.Status, result.Reason = StatusOpen, ReasonSynAck
+
+	// Pure reachability sweeps stop here
+	if opts.DisableBanner {
+		result.Service = serviceForPort(port)
+		return result, nil
+	}
+
+	// Unblock any pending read or write as soon as the scan is cancelled
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	engine := opts.Probes
+	if engine == nil {
+		engine = DefaultProbes()
+	}
+
+	// Probe the service on the same connection, inside a TLS session for
+	// ports that expect one. A failed handshake spoils the connection, so
+	// probing then starts over in plaintext.
+	name := opts.targetName(host)
+	var first net.Conn = conn
+	if TLSPorts[port] {
+		tlsConn, info, err := handshakeTLS(ctx, conn, serverNameFor(name), opts.Timeout)
+		if err == nil {
+			first, result.TLS = tlsConn, info
+		} else {
+			first = nil
+		}
+	}
+	session := newProbeSession(ctx, engine, host, port, result.TLS != nil, opts)
+	probed := session.probeService(ctx, first)
+
+	// A silent service on an unexpected port may be waiting for a ClientHello
+	if probed.banner == "" && probed.match == nil && result.TLS == nil && opts.DetectTLS && ctx.Err() == nil {
+		if tlsConn, info, err := dialTLS(ctx, opts, address, name); err == nil {
+			result.TLS = info
+			session = newProbeSession(ctx, engine, host, port, true, opts)
+			probed = session.probeService(ctx, tlsConn)
+		}
+	}
+
+	result.Service = serviceForPort(port)
+	if probed.match != nil {
+		result.applyMatch(probed.match)
+	}
+	if probed.banner != "" {
+		result.FirstByte = probed.firstByte
+		result.Banner = cleanBanner(probed.banner)
+		result.Body = GetBody(probed.banner)
+	}
+
+	// Anything that answered like a web server gets its response parsed
+	if info, body, ok := parseHTTPResponse([]byte(probed.banner)); ok {
+		result.HTTP = info
+		result.Body = cleanBanner(body)
+		if opts.FollowRedirects > 0 {
+			session.followRedirects(ctx, info, host, opts.FollowRedirects)
+		}
+	}
+	return result, nil
+}
+
+// newProbeSession prepares service probing for an open port, reached in
+// TLS when useTLS is set
+func newProbeSession(ctx context.Context, engine *probes.Engine, host string, port int, useTLS bool, opts ProbeOptions) *probeSession {
+	return &probeSession{
+		engine:   engine,
+		redial:   redialer(ctx, opts, host, opts.targetName(host), port, useTLS),
+		opts:     opts,
+		port:     port,
+		tls:      useTLS,
+		httpHost: hostHeader(opts.targetName(host), port, useTLS),
+		timeout:  opts.Timeout,
+	}
+}
+
+// redialer returns a function that opens a new connection to a port of host,
+// wrapped in TLS for serverName when the service speaks it
+func redialer(ctx context.Context, opts ProbeOptions, host, serverName string, port int, useTLS bool) func() (net.Conn, error) {
+	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
+	return func() (net.Conn, error) {
+		if useTLS {
+			conn, _, err := dialTLS(ctx, opts, address, serverName)
+			return conn, err
+		}
+		return opts.dial(ctx, "tcp", address, opts.Timeout, false)
+	}
 }
 
 // cleanBanner removes non-printable characters and trims the banner
@@ -112,31 +212,3 @@ func GetBody(cleanedBanner string) string {
 	// Return empty string if no body tags found
 	return ""
 }
-
-// GetAllPorts returns a range of ports (1-65535)
-func GetAllPorts() []int {
-	ports := make([]int, 65535)
-	for i := 0; i < 65535; i++ {
-		ports[i] = i + 1
-	}
-	return ports
-}
-
-// GetPortRange returns a range of ports
-func GetPortRange(start, end int) []int {
-	if start < 1 {
-		start = 1
-	}
-	if end > 65535 {
-		end = 65535
-	}
-	if start > end {
-		start, end = end, start
-	}
-
-	ports := make([]int, end-start+1)
-	for i := range ports {
-		ports[i] = start + i
-	}
-	return ports
-}
@@ -0,0 +1,148 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"metron_code_jam/internal/probes"
+	"metron_code_jam/pkg/metronet/fakenet"
+)
+
+// testProbes are small probe definitions with short waits, so tests do not
+// depend on the built-in set
+const testProbes = `
+Probe TCP NULL q||
+totalwaitms 100
+match ssh m|^SSH-[\d.]+-OpenSSH_([\w.]+)| p/OpenSSH/ v/$1/
+softmatch ftp m|^220 |
+
+Probe TCP GetRequest q|GET / HTTP/1.0\r\n\r\n|
+rarity 1
+match http m|^HTTP/1\.[01] \d\d\d .*\r\nServer: (\w+)|s p/$1/
+
+Probe TCP Help q|HELP\r\n|
+rarity 2
+match ftp m|^220 .*\r\n214 | p/ExampleFTP/
+`
+
+func testEngine(t *testing.T) *probes.Engine {
+	t.Helper()
+	e := probes.New()
+	if err := e.Load(strings.NewReader(testProbes), "test"); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// testNetwork declares the services the scanner tests run against
+func testNetwork(t *testing.T) *fakenet.Network {
+	t.Helper()
+	n := fakenet.New()
+	ports := []struct {
+		network string
+		address string
+		port    fakenet.Port
+	}{
+		{"tcp", "10.0.0.1:22", fakenet.Port{State: fakenet.Open, Banner: "SSH-2.0-OpenSSH_9.6\r\n"}},
+		{"tcp", "10.0.0.1:8000", fakenet.Port{State: fakenet.Open, Replies: []fakenet.Reply{
+			{Match: []byte("GET "), Send: []byte("HTTP/1.0 200 OK\r\nServer: Example\r\n\r\n"), Close: true},
+		}}},
+		{"tcp", "10.0.0.1:2121", fakenet.Port{State: fakenet.Open, Banner: "220 ready\r\n", Replies: []fakenet.Reply{
+			{Match: []byte("HELP"), Send: []byte("214 ok\r\n")},
+		}}},
+		{"tcp", "10.0.0.1:9999", fakenet.Port{State: fakenet.Open, Banner: "hello\r\n"}},
+		{"tcp", "10.0.0.1:81", fakenet.Port{State: fakenet.Filtered}},
+		{"tcp", "10.0.0.1:82", fakenet.Port{State: fakenet.Open, Delay: time.Second}},
+		{"udp", "10.0.0.1:53", fakenet.Port{State: fakenet.Open, Replies: []fakenet.Reply{{Send: []byte("answer")}}}},
+		{"udp", "10.0.0.1:123", fakenet.Port{State: fakenet.Filtered}},
+		{"udp", "10.0.0.1:124", fakenet.Port{State: fakenet.Open}},
+	}
+	for _, p := range ports {
+		if err := n.Set(p.network, p.address, p.port); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n.SetHost("10.0.0.2", fakenet.Filtered)
+	return n
+}
+
+func TestScanPort(t *testing.T) {
+	n := testNetwork(t)
+	opts := ProbeOptions{Timeout: 200 * time.Millisecond, Probes: testEngine(t), Dialer: n}
+
+	tests := []struct {
+		host    string
+		port    int
+		status  PortStatus
+		reason  Reason
+		service string
+		product string
+	}{
+		{"10.0.0.1", 22, StatusOpen, ReasonSynAck, "ssh", "OpenSSH"},
+		{"10.0.0.1", 8000, StatusOpen, ReasonSynAck, "http", "Example"},
+		{"10.0.0.1", 9999, StatusOpen, ReasonSynAck, "unknown", ""},
+		{"10.0.0.1", 80, StatusClosed, ReasonRefused, "", ""},
+		{"10.0.0.1", 81, StatusFiltered, ReasonNoResponse, "", ""},
+		{"10.0.0.1", 82, StatusFiltered, ReasonNoResponse, "", ""},
+		{"10.0.0.2", 22, StatusFiltered, ReasonNoResponse, "", ""},
+	}
+	for _, tt := range tests {
+		result, err := scanPort(context.Background(), tt.host, tt.port, opts)
+		if err != nil {
+			t.Errorf("%s:%d: %v", tt.host, tt.port, err)
+			continue
+		}
+		if result.Status != tt.status || result.Reason != tt.reason {
+			t.Errorf("%s:%d = %s (%s), want %s (%s)", tt.host, tt.port, result.Status, result.Reason, tt.status, tt.reason)
+		}
+		if result.Service != tt.service || result.Product != tt.product {
+			t.Errorf("%s:%d service = %q %q, want %q %q", tt.host, tt.port, result.Service, result.Product, tt.service, tt.product)
+		}
+	}
+}
+
+func TestScanPortWithoutBanners(t *testing.T) {
+	n := testNetwork(t)
+	opts := ProbeOptions{Timeout: 200 * time.Millisecond, DisableBanner: true, Dialer: n}
+
+	result, err := scanPort(context.Background(), "10.0.0.1", 22, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != StatusOpen || result.Banner != "" || result.Service != "ssh" {
+		t.Errorf("got %s %q %q, want an open ssh port without banner", result.Status, result.Service, result.Banner)
+	}
+	if dials := n.Dials("tcp", "10.0.0.1:22"); dials != 1 {
+		t.Errorf("port dialed %d times, want 1", dials)
+	}
+}
+
+func TestScanPortCancelled(t *testing.T) {
+	n := testNetwork(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := scanPort(ctx, "10.0.0.1", 81, ProbeOptions{Timeout: time.Second, Dialer: n})
+	if err != context.Canceled {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+}
+
+func TestScanPortFirstByte(t *testing.T) {
+	n := testNetwork(t)
+	opts := ProbeOptions{Timeout: 200 * time.Millisecond, Probes: testEngine(t), Dialer: n}
+
+	// The NULL probe waits 100ms for nothing before GetRequest is answered
+	result, err := scanPort(context.Background(), "10.0.0.1", 8000, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FirstByte <= 0 || result.FirstByte >= 100*time.Millisecond {
+		t.Errorf("FirstByte = %v, want the GetRequest round trip alone", result.FirstByte)
+	}
+	if result.Duration < 100*time.Millisecond {
+		t.Errorf("Duration = %v, want the NULL probe's wait included", result.Duration)
+	}
+}
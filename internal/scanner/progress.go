@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"math"
+	"time"
+
+	"metron_code_jam/internal/network"
+)
+
+// Progress is a snapshot of a running scan, passed to ScanConfig.OnProgress
+type Progress struct {
+	PortsDone  int // ports scanned on all targets so far
+	PortsTotal int // ports to scan on all targets; zero if too many to count
+	OpenPorts  int
+	HostsDone  int // targets finished; not counted in interleaved sweeps
+	HostsTotal int
+	// Hosts are the targets being scanned right now; empty for interleaved
+	// sweeps, which work on every target at once
+	Hosts   []HostProgress
+	Elapsed time.Duration
+	Rate    float64       // ports scanned per second since the last report
+	ETA     time.Duration // time left at the average rate of this run; zero when unknown
+}
+
+// HostProgress is how far the scan of one active target has got
+type HostProgress struct {
+	Target     network.Target
+	PortsDone  int
+	PortsTotal int
+	OpenPorts  int
+}
+
+// Percent returns the share of ports scanned, from 0 to 100
+func (p Progress) Percent() float64 {
+	if p.PortsTotal == 0 {
+		return 0
+	}
+	return 100 * float64(p.PortsDone) / float64(p.PortsTotal)
+}
+
+// progressState is what the scanner keeps between progress reports
+type progressState struct {
+	started    time.Time
+	portsTotal int
+	hostsTotal int
+	hostsDone  int
+	// Ports scanned in this run as of the last report
+	lastScanned int
+	lastAt      time.Time
+}
+
+// startProgress counts the work ahead for progress reports
+func (s *Scanner) startProgress(started time.Time) {
+	hosts := 1
+	if s.config.Targets != nil {
+		hosts = s.config.Targets.Len()
+	}
+	ports := s.portCount()
+
+	s.progress = progressState{started: started, hostsTotal: hosts, lastAt: started}
+	if hosts <= math.MaxInt/ports {
+		s.progress.portsTotal = hosts * ports
+	}
+}
+
+// progressTicks returns a channel that ticks every ProgressInterval while
+// OnProgress is set, or nil, and a function to stop it
+func (s *Scanner) progressTicks() (<-chan time.Time, func()) {
+	if s.config.OnProgress == nil {
+		return nil, func() {}
+	}
+	t := time.NewTicker(s.config.ProgressInterval)
+	return t.C, t.Stop
+}
+
+// reportProgress passes a snapshot of the scan to OnProgress. It must be
+// called from the goroutine that delivers results.
+func (s *Scanner) reportProgress(hosts []HostProgress) {
+	if s.config.OnProgress == nil {
+		return
+	}
+	s.mu.Lock()
+	done, open, resumed := s.stats.TotalPorts, s.stats.OpenPorts, s.stats.resumed
+	s.mu.Unlock()
+
+	now := time.Now()
+	p := Progress{
+		PortsDone:  done,
+		PortsTotal: s.progress.portsTotal,
+		OpenPorts:  open,
+		HostsDone:  s.progress.hostsDone,
+		HostsTotal: s.progress.hostsTotal,
+		Hosts:      hosts,
+		Elapsed:    now.Sub(s.progress.started),
+	}
+	scanned := done - resumed
+	if since := now.Sub(s.progress.lastAt); since > 0 {
+		p.Rate = float64(scanned-s.progress.lastScanned) / since.Seconds()
+	}
+	if scanned > 0 && p.PortsTotal > done {
+		p.ETA = time.Duration(float64(p.Elapsed) * float64(p.PortsTotal-done) / float64(scanned)).Round(time.Second)
+	}
+	s.progress.lastScanned, s.progress.lastAt = scanned, now
+
+	s.config.OnProgress(p)
+}
+
+// hostProgress lists how far each active target has got
+func hostProgress(active []*hostScan, portsPerHost int) []HostProgress {
+	hosts := make([]HostProgress, 0, len(active))
+	for _, h := range active {
+		hosts = append(hosts, HostProgress{
+			Target:     h.target,
+			PortsDone:  h.stats.TotalPorts,
+			PortsTotal: portsPerHost,
+			OpenPorts:  h.stats.OpenPorts,
+		})
+	}
+	return hosts
+}
@@ -0,0 +1,49 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by all workers of a scan. Tokens
+// accumulate at rate per second up to burst, and each port scan takes one.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing rate scans per second on average
+// and up to burst at once after an idle period
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until a token is available. Tokens are handed out in the order
+// callers arrive: each one reserves the next token, even a future one, and
+// sleeps until it is due. It returns false if ctx was cancelled first.
+func (l *rateLimiter) wait(ctx context.Context) bool {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return ctx.Err() == nil
+	}
+	return sleepContext(ctx, delay)
+}
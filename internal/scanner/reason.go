@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"errors"
+	"net"
+	"syscall"
+
+	"metron_code_jam/internal/proxy"
+)
+
+// Reason tells what the scanner observed to decide the status of a port
+type Reason string
+
+const (
+	ReasonSynAck       Reason = "syn-ack"      // the TCP handshake completed
+	ReasonUDPResponse  Reason = "udp-response" // the UDP probe got a reply
+	ReasonRefused      Reason = "conn-refused" // TCP reset in answer to the SYN
+	ReasonPortUnreach  Reason = "port-unreach" // ICMP port unreachable (UDP)
+	ReasonReset        Reason = "reset"        // the connection was reset while opening
+	ReasonNoResponse   Reason = "no-response"  // nothing came back before the timeout
+	ReasonHostUnreach  Reason = "host-unreach"
+	ReasonNetUnreach   Reason = "net-unreach"
+	ReasonFDExhausted  Reason = "fd-exhausted"  // EMFILE or ENFILE: no file descriptor left here
+	ReasonNoResources  Reason = "no-resources"  // local buffers or ephemeral ports ran out
+	ReasonPermission   Reason = "permission"    // EACCES or EPERM, e.g. a local firewall rule
+	ReasonLocalFailure Reason = "local-failure" // any other error
+
+	// Failures of a proxy, which leave the port's state unknown
+	ReasonProxyUnreach Reason = "proxy-unreach" // the proxy could not be reached
+	ReasonProxyAuth    Reason = "proxy-auth"    // the proxy rejected the credentials
+	ReasonProxyDenied  Reason = "proxy-denied"  // the proxy's rules forbid the connection
+	ReasonProxyGateway Reason = "proxy-gateway" // an HTTP proxy answered 502 or 503
+	ReasonProxyFailure Reason = "proxy-failure" // any other error of the proxy
+)
+
+// classifyError maps the error of a connect, or of a UDP exchange, to the
+// status it implies for the port. Failures on this side of the network say
+// nothing about the target, so they give StatusError, never StatusClosed;
+// failures of a proxy give StatusProxyError.
+func classifyError(err error) (PortStatus, Reason) {
+	var netErr net.Error
+	var proxyErr *proxy.Error
+	switch {
+	case errors.As(err, &proxyErr):
+		return StatusProxyError, proxyReason(proxyErr)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return StatusClosed, ReasonRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return StatusClosed, ReasonReset
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return StatusFiltered, ReasonHostUnreach
+	case errors.Is(err, syscall.ENETUNREACH):
+		return StatusFiltered, ReasonNetUnreach
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return StatusFiltered, ReasonNoResponse
+	case errors.Is(err, syscall.EMFILE), errors.Is(err, syscall.ENFILE):
+		return StatusError, ReasonFDExhausted
+	case errors.Is(err, syscall.ENOBUFS), errors.Is(err, syscall.ENOMEM),
+		errors.Is(err, syscall.EAGAIN), errors.Is(err, syscall.EADDRNOTAVAIL):
+		return StatusError, ReasonNoResources
+	case errors.Is(err, syscall.EACCES), errors.Is(err, syscall.EPERM):
+		return StatusError, ReasonPermission
+	default:
+		return StatusError, ReasonLocalFailure
+	}
+}
+
+// proxyReason tells why a proxy failed
+func proxyReason(err *proxy.Error) Reason {
+	switch {
+	case err.Op == "dial":
+		return ReasonProxyUnreach
+	case errors.Is(err, proxy.ErrAuth):
+		return ReasonProxyAuth
+	case errors.Is(err, proxy.ErrDenied):
+		return ReasonProxyDenied
+	case errors.Is(err, proxy.ErrGateway):
+		return ReasonProxyGateway
+	default:
+		return ReasonProxyFailure
+	}
+}
+
+// retryable reports whether another attempt at the port may give a
+// different answer: it did not respond in time, a local resource ran out or
+// the proxy could not be reached
+func (r ScanResult) retryable() bool {
+	switch r.Reason {
+	case ReasonNoResponse, ReasonFDExhausted, ReasonNoResources, ReasonProxyUnreach:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"metron_code_jam/internal/proxy"
+)
+
+func TestClassifyError(t *testing.T) {
+	dialErr := func(errno syscall.Errno) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)}
+	}
+	proxyErr := func(op string, err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: &proxy.Error{Proxy: "socks5://127.0.0.1:1080", Op: op, Err: err}}
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		status PortStatus
+		reason Reason
+	}{
+		{"refused", dialErr(syscall.ECONNREFUSED), StatusClosed, ReasonRefused},
+		{"reset", dialErr(syscall.ECONNRESET), StatusClosed, ReasonReset},
+		{"host unreachable", dialErr(syscall.EHOSTUNREACH), StatusFiltered, ReasonHostUnreach},
+		{"net unreachable", dialErr(syscall.ENETUNREACH), StatusFiltered, ReasonNetUnreach},
+		{"timeout", &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, StatusFiltered, ReasonNoResponse},
+		{"too many files", dialErr(syscall.EMFILE), StatusError, ReasonFDExhausted},
+		{"file table full", dialErr(syscall.ENFILE), StatusError, ReasonFDExhausted},
+		{"no buffers", dialErr(syscall.ENOBUFS), StatusError, ReasonNoResources},
+		{"no ephemeral port", dialErr(syscall.EADDRNOTAVAIL), StatusError, ReasonNoResources},
+		{"firewall", dialErr(syscall.EPERM), StatusError, ReasonPermission},
+		{"other", errors.New("something broke"), StatusError, ReasonLocalFailure},
+		{"proxy unreachable", proxyErr("dial", dialErr(syscall.ECONNREFUSED)), StatusProxyError, ReasonProxyUnreach},
+		{"proxy auth", proxyErr("handshake", proxy.ErrAuth), StatusProxyError, ReasonProxyAuth},
+		{"proxy rules", proxyErr("handshake", proxy.ErrDenied), StatusProxyError, ReasonProxyDenied},
+		{"proxy bad gateway", proxyErr("handshake", fmt.Errorf("%w: 502 Bad Gateway", proxy.ErrGateway)), StatusProxyError, ReasonProxyGateway},
+		{"proxy other", proxyErr("handshake", errors.New("bad reply")), StatusProxyError, ReasonProxyFailure},
+	}
+	for _, tt := range tests {
+		status, reason := classifyError(tt.err)
+		if status != tt.status || reason != tt.reason {
+			t.Errorf("%s: got %s (%s), want %s (%s)", tt.name, status, reason, tt.status, tt.reason)
+		}
+	}
+}
+
+func TestClassifyUDPError(t *testing.T) {
+	refused := &net.OpError{Op: "read", Net: "udp", Err: os.NewSyscallError("recvfrom", syscall.ECONNREFUSED)}
+	if status, reason := classifyUDPError(refused); status != StatusClosed || reason != ReasonPortUnreach {
+		t.Errorf("port unreachable: got %s (%s)", status, reason)
+	}
+	timeout := &net.OpError{Op: "read", Net: "udp", Err: os.ErrDeadlineExceeded}
+	if status, reason := classifyUDPError(timeout); status != StatusOpenFiltered || reason != ReasonNoResponse {
+		t.Errorf("silence: got %s (%s)", status, reason)
+	}
+}
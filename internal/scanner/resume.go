@@ -0,0 +1,88 @@
+package scanner
+
+// portKey identifies one port of one target
+type portKey struct {
+	host  string
+	port  int
+	proto Protocol
+}
+
+// completedPorts indexes the results of an earlier run given in
+// ScanConfig.Completed
+type completedPorts struct {
+	done   map[portKey]bool
+	byHost map[string][]ScanResult
+}
+
+// newCompletedPorts indexes results by target and port; it returns nil when
+// there are none
+func newCompletedPorts(results []ScanResult) *completedPorts {
+	if len(results) == 0 {
+		return nil
+	}
+	c := &completedPorts{
+		done:   make(map[portKey]bool, len(results)),
+		byHost: make(map[string][]ScanResult),
+	}
+	for _, r := range results {
+		key := portKey{r.Host, r.Port, r.Protocol}
+		if c.done[key] {
+			continue
+		}
+		c.done[key] = true
+		c.byHost[r.Host] = append(c.byHost[r.Host], r)
+	}
+	return c
+}
+
+// has reports whether the port already has a result
+func (c *completedPorts) has(host string, port int, proto Protocol) bool {
+	return c != nil && c.done[portKey{host, port, proto}]
+}
+
+// seedHost counts the earlier results of a target as if they had just been
+// scanned, without passing them to OnResult
+func (s *Scanner) seedHost(h *hostScan) {
+	if s.completed == nil {
+		return
+	}
+	for _, r := range s.completed.byHost[h.target.IP] {
+		h.stats.addResumed(r)
+		s.addResumed(r)
+		if !s.config.DiscardResults {
+			h.results = append(h.results, r)
+		}
+	}
+}
+
+// addResumed counts an earlier result in the statistics of the whole scan
+func (s *Scanner) addResumed(r ScanResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.addResumed(r)
+}
+
+// addResumed counts an earlier result, which took no time in this run
+func (st *ScanStatistics) addResumed(r ScanResult) {
+	st.add(r)
+	st.resumed++
+}
+
+// seedAll counts all earlier results for an interleaved sweep and returns
+// them unless results are discarded
+func (s *Scanner) seedAll() []ScanResult {
+	if s.completed == nil {
+		return nil
+	}
+	var results []ScanResult
+	for _, hostResults := range s.completed.byHost {
+		for _, r := range hostResults {
+			s.addResumed(r)
+			if !s.config.DiscardResults {
+				results = append(results, r)
+			}
+		}
+	}
+	return results
+}
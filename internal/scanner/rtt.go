@@ -0,0 +1,66 @@
+package scanner
+
+import (
+	"sync"
+	"time"
+)
+
+// rttGranularity is the G term of RFC 6298: the smallest margin ever added
+// to the smoothed round-trip time
+const rttGranularity = 10 * time.Millisecond
+
+// rttEstimator derives the timeout for a host from the round-trip times
+// measured so far, the way TCP computes its retransmission timeout (RFC 6298):
+// the smoothed RTT plus four times its variation, within [min, max]. Until
+// the first sample arrives the timeout is initial.
+type rttEstimator struct {
+	mu       sync.Mutex
+	srtt     time.Duration
+	rttvar   time.Duration
+	sampled  bool
+	initial  time.Duration
+	min, max time.Duration
+}
+
+// newRTTEstimator returns an estimator starting from the initial timeout
+func newRTTEstimator(initial, min, max time.Duration) *rttEstimator {
+	return &rttEstimator{initial: initial, min: min, max: max}
+}
+
+// sample records a measured round-trip time. It is safe to call on a nil
+// estimator, which ignores it.
+func (e *rttEstimator) sample(rtt time.Duration) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.sampled {
+		e.srtt, e.rttvar, e.sampled = rtt, rtt/2, true
+		return
+	}
+	diff := e.srtt - rtt
+	if diff < 0 {
+		diff = -diff
+	}
+	e.rttvar = (3*e.rttvar + diff) / 4
+	e.srtt = (7*e.srtt + rtt) / 8
+}
+
+// timeout returns the current timeout, doubled for each earlier attempt
+// that timed out, within [min, max]
+func (e *rttEstimator) timeout(attempt int) time.Duration {
+	e.mu.Lock()
+	rto := e.initial
+	if e.sampled {
+		rto = e.srtt + max(rttGranularity, 4*e.rttvar)
+	}
+	e.mu.Unlock()
+
+	rto = max(rto, e.min)
+	for ; attempt > 0 && rto < e.max; attempt-- {
+		rto *= 2
+	}
+	return min(rto, e.max)
+}
@@ -1,17 +1,43 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
-	"math/rand"
+	"iter"
+	"log/slog"
 	"sync"
 	"time"
+
+	"metron_code_jam/internal/network"
 )
 
+// localBackoff is the pause before retrying a port that failed because a
+// local resource ran out, or the proxy was unreachable; it doubles with each
+// attempt
+const localBackoff = 100 * time.Millisecond
+
+// maxDoublings bounds how often retries double a fixed timeout or the local
+// backoff, so neither grows past 8 times its first value
+const maxDoublings = 3
+
+// doubled returns d doubled once for each earlier attempt, at most
+// maxDoublings times
+func doubled(d time.Duration, attempt int) time.Duration {
+	return d << min(attempt, maxDoublings)
+}
+
 // Scanner is the main scanner orchestrator
 type Scanner struct {
-	config ScanConfig
-	mu     sync.Mutex
-	stats  ScanStatistics
+	config  ScanConfig
+	limiter *rateLimiter // nil when the rate is unlimited
+	// rtts holds the timeout estimator of each target of an interleaved
+	// sweep. Only the goroutine generating jobs touches it.
+	rtts  map[string]*rttEstimator
+	mu    sync.Mutex
+	stats ScanStatistics
+
+	progress  progressState
+	completed *completedPorts // ports scanned by an earlier run
 }
 
 // NewScanner creates a new scanner with the given configuration
@@ -23,52 +49,215 @@ func NewScanner(config ScanConfig) *Scanner {
 	if config.MaxConcurrency == 0 {
 		config.MaxConcurrency = 100
 	}
+	if config.Protocol == "" {
+		config.Protocol = ProtocolTCP
+	}
+	if config.MaxTimeout == 0 {
+		config.MaxTimeout = config.Timeout
+	}
+	if config.MinTimeout == 0 {
+		config.MinTimeout = min(100*time.Millisecond, config.MaxTimeout)
+	}
+	if config.ParallelHosts == 0 {
+		// Enough targets to keep every worker busy under the per-host cap
+		config.ParallelHosts = 32
+		if config.MaxPerHost > 0 {
+			config.ParallelHosts = max(config.ParallelHosts, (config.MaxConcurrency+config.MaxPerHost-1)/config.MaxPerHost)
+		}
+	}
+
+	if config.ProgressInterval <= 0 {
+		config.ProgressInterval = time.Second
+	}
+	if config.Logger == nil {
+		config.Logger = slog.New(slog.DiscardHandler)
+	}
 
-	return &Scanner{
+	if config.Rate > 0 && config.Burst <= 0 {
+		config.Burst = max(1, int(config.Rate/10))
+	}
+
+	s := &Scanner{
 		config: config,
 	}
+	if config.Rate > 0 {
+		s.limiter = newRateLimiter(config.Rate, config.Burst)
+	}
+	s.rtts = make(map[string]*rttEstimator)
+	s.completed = newCompletedPorts(config.Completed)
+	return s
 }
 
 // Scan performs the port scan and returns results
 func (s *Scanner) Scan() ([]ScanResult, ScanStatistics, error) {
+	return s.ScanContext(context.Background())
+}
+
+// ScanContext performs the port scan and returns results. Each result is also
+// passed to ScanConfig.OnResult as soon as it is available. When ctx is
+// cancelled or its deadline passes, all workers stop promptly and the results
+// collected so far are returned together with ctx.Err().
+func (s *Scanner) ScanContext(ctx context.Context) ([]ScanResult, ScanStatistics, error) {
 	startTime := time.Now()
 
 	// Validate host
-	if s.config.Host == "" {
+	if s.config.Host == "" && s.config.Targets == nil {
 		return nil, ScanStatistics{}, fmt.Errorf("host cannot be empty")
 	}
-
-	// Prepare ports
-	ports := s.config.Ports
-	if len(ports) == 0 {
+	if s.config.Protocol != ProtocolTCP && s.config.Protocol != ProtocolUDP {
+		return nil, ScanStatistics{}, fmt.Errorf("unsupported protocol: %s", s.config.Protocol)
+	}
+	if s.portCount() == 0 {
 		return nil, ScanStatistics{}, fmt.Errorf("ports cannot be empty")
 	}
-
-	// Randomize port order if requested
-	if s.config.RandomizeOrder {
-		s.customShufflePorts(ports)
-		fmt.Println(s.config.Ports)
+	if s.config.Proxy != nil && (s.config.Protocol == ProtocolUDP || s.config.UDPPorts.Len() > 0) {
+		return nil, ScanStatistics{}, fmt.Errorf("UDP ports cannot be scanned through a proxy")
+	}
+	if s.config.Proxy != nil && s.config.Source.Port != 0 {
+		return nil, ScanStatistics{}, fmt.Errorf("a source port cannot be used through a proxy")
+	}
+	if s.config.Source.Port != 0 && !canShareSourcePort && s.config.MaxConcurrency > 1 {
+		return nil, ScanStatistics{}, fmt.Errorf("a source port can only be shared by concurrent connections on Linux: set the concurrency to 1")
+	}
+	if s.config.Dialer != nil && !s.config.Source.isZero() {
+		return nil, ScanStatistics{}, fmt.Errorf("a source cannot be combined with a custom dialer")
+	}
+	if err := s.config.Source.Validate(); err != nil {
+		return nil, ScanStatistics{}, err
 	}
 
 	// Initialize statistics
-	s.stats = ScanStatistics{
-		TotalPorts: len(ports),
+	s.stats = ScanStatistics{}
+	if s.config.OnProgress != nil {
+		s.startProgress(startTime)
 	}
+	s.config.Logger.Info("scan started",
+		"ports", s.config.Ports.Len(),
+		"protocol", s.config.Protocol,
+		"udp_ports", s.config.UDPPorts.Len(),
+		"concurrency", s.config.MaxConcurrency,
+		"interleave", s.config.Interleave)
 
 	// Scan ports concurrently
-	results := s.scanConcurrent(ports) // Concurrent Scan here
+	var results []ScanResult
+	if s.config.Interleave {
+		results = append(s.seedAll(), s.scanConcurrent(ctx, s.jobs())...)
+	} else {
+		results = s.schedule(ctx) // Concurrent Scan here
+	}
 
 	// Calculate statistics
-	s.stats.ScanDuration = time.Since(startTime)
+	s.stats.finish(time.Since(startTime))
+	s.reportProgress(nil)
+	s.config.Logger.Info("scan finished",
+		"ports", s.stats.TotalPorts,
+		"open", s.stats.OpenPorts,
+		"duration", s.stats.ScanDuration,
+		"rate", s.stats.Rate,
+		"interrupted", ctx.Err() != nil)
+
+	return results, s.stats, ctx.Err()
+}
+
+// job is one port of one target
+type job struct {
+	target network.Target
+	port   protoPort
+	rtt    *rttEstimator // timeouts for the target; nil for fixed timeouts
+}
+
+// protoPort is a port and the protocol to scan it over
+type protoPort struct {
+	port  int
+	proto Protocol
+}
+
+// jobs yields the target and port pairs to scan. They are generated as the
+// workers ask for them, so memory does not grow with the size of the scan.
+func (s *Scanner) jobs() iter.Seq[job] {
+	targets := s.targets()
+	if s.config.Interleave {
+		return func(yield func(job) bool) {
+			for port := range s.portOrder() {
+				for target := range targets {
+					if s.completed.has(target.IP, port.port, port.proto) {
+						continue
+					}
+					if !yield(job{target, port, s.hostRTT(target.IP)}) {
+						return
+					}
+				}
+			}
+		}
+	}
+	return func(yield func(job) bool) {
+		for target := range targets {
+			for port := range s.portOrder() {
+				if s.completed.has(target.IP, port.port, port.proto) {
+					continue
+				}
+				if !yield(job{target, port, s.hostRTT(target.IP)}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// targets yields the configured targets, or the single configured host
+func (s *Scanner) targets() iter.Seq[network.Target] {
+	if s.config.Targets != nil {
+		return s.config.Targets.All()
+	}
+	return func(yield func(network.Target) bool) {
+		yield(network.Target{IP: s.config.Host, Hostname: s.config.Hostname})
+	}
+}
+
+// portCount returns the number of ports to scan on each target
+func (s *Scanner) portCount() int {
+	return s.config.Ports.Len() + s.config.UDPPorts.Len()
+}
 
-	return results, s.stats, nil
+// portOrder yields the ports to scan, Ports first and then UDPPorts, or in a
+// new random order on each call if RandomizeOrder is set
+func (s *Scanner) portOrder() iter.Seq[protoPort] {
+	ports, udpPorts := s.config.Ports, s.config.UDPPorts
+	if !s.config.RandomizeOrder {
+		return func(yield func(protoPort) bool) {
+			for port := range ports.All() {
+				if !yield(protoPort{port, s.config.Protocol}) {
+					return
+				}
+			}
+			for port := range udpPorts.All() {
+				if !yield(protoPort{port, ProtocolUDP}) {
+					return
+				}
+			}
+		}
+	}
+	return func(yield func(protoPort) bool) {
+		n := ports.Len()
+		for i := range shuffledIndexes(s.portCount(), time.Now().UnixNano()) {
+			p := protoPort{proto: s.config.Protocol}
+			if i < n {
+				p.port = ports.At(i)
+			} else {
+				p.port, p.proto = udpPorts.At(i-n), ProtocolUDP
+			}
+			if !yield(p) {
+				return
+			}
+		}
+	}
 }
 
-// scanConcurrent scans ports using a worker pool pattern for proper concurrency control
-func (s *Scanner) scanConcurrent(ports []int) []ScanResult {
-	results := make([]ScanResult, 0, len(ports))
-	resultsChan := make(chan ScanResult, len(ports))
-	portsChan := make(chan int, len(ports))
+// scanConcurrent scans jobs using a worker pool pattern for proper concurrency control
+func (s *Scanner) scanConcurrent(ctx context.Context, jobs iter.Seq[job]) []ScanResult {
+	var results []ScanResult
+	resultsChan := make(chan ScanResult, s.config.MaxConcurrency)
+	jobsChan := make(chan job)
 	var wg sync.WaitGroup
 
 	// Start worker pool with MaxConcurrency workers
@@ -78,14 +267,17 @@ func (s *Scanner) scanConcurrent(ports []int) []ScanResult {
 			defer wg.Done()
 
 			// Each worker processes ports from the channel
-			for port := range portsChan {
-				// Add delay if configured (between scans, not while idle)
-				if s.config.DelayBetween > 0 {
-					time.Sleep(s.config.DelayBetween)
+			for j := range jobsChan {
+				// Keep to the configured delay and rate
+				if !s.pace(ctx) {
+					return
 				}
 
-				// Scan the port
-				result := ScanPort(s.config.Host, port, s.config.Timeout)
+				// Scan the port; a port interrupted by cancellation has no result
+				result, err := s.scanPort(ctx, j)
+				if err != nil {
+					return
+				}
 
 				// Update statistics
 				s.updateStats(result)
@@ -96,12 +288,16 @@ func (s *Scanner) scanConcurrent(ports []int) []ScanResult {
 		}()
 	}
 
-	// Send all ports to the work channel
+	// Feed jobs to the workers until they run out or the context is done
 	go func() {
-		for _, port := range ports {
-			portsChan <- port
+		defer close(jobsChan)
+		for j := range jobs {
+			select {
+			case jobsChan <- j:
+			case <-ctx.Done():
+				return
+			}
 		}
-		close(portsChan)
 	}()
 
 	// Wait for all workers to complete and close results channel
@@ -111,11 +307,138 @@ func (s *Scanner) scanConcurrent(ports []int) []ScanResult {
 	}()
 
 	// Collect results
-	for result := range resultsChan {
-		results = append(results, result)
+	ticks, stopTicks := s.progressTicks()
+	defer stopTicks()
+	for {
+		select {
+		case result, ok := <-resultsChan:
+			if !ok {
+				return results
+			}
+			if s.config.OnResult != nil {
+				s.config.OnResult(result)
+			}
+			if !s.config.DiscardResults {
+				results = append(results, result)
+			}
+		case <-ticks:
+			s.reportProgress(nil)
+		}
+	}
+}
+
+// scanPort probes a single port using the configured protocol. Ports that
+// time out or hit a local resource limit are tried again, up to Retries more
+// times, with the timeout doubled on each attempt: up to MaxTimeout for
+// adaptive timeouts, up to 8 times Timeout for fixed ones.
+func (s *Scanner) scanPort(ctx context.Context, j job) (ScanResult, error) {
+	opts := s.probeOptions(j.target)
+	opts.rtt = j.rtt
+	for attempt := 0; ; attempt++ {
+		if j.rtt != nil {
+			opts.ConnectTimeout = j.rtt.timeout(attempt)
+		} else {
+			opts.ConnectTimeout = doubled(s.config.Timeout, attempt)
+		}
+
+		// Per-port logging is skipped entirely unless enabled, as it costs
+		// allocations on every port of a sweep
+		debug := s.config.Logger.Enabled(ctx, slog.LevelDebug)
+		if debug {
+			s.config.Logger.Debug("scanning port", "host", j.target.IP, "port", j.port.port, "protocol", j.port.proto, "attempt", attempt, "timeout", opts.connectTimeout())
+		}
+
+		var result ScanResult
+		var err error
+		if j.port.proto == ProtocolUDP {
+			result, err = scanUDPPort(ctx, j.target.IP, j.port.port, opts)
+		} else {
+			result, err = scanPort(ctx, j.target.IP, j.port.port, opts)
+		}
+		if err != nil {
+			return result, err
+		}
+		if debug {
+			s.config.Logger.Debug("port scanned", "host", j.target.IP, "port", j.port.port, "protocol", j.port.proto,
+				"status", result.Status, "reason", result.Reason,
+				"latency", result.Latency, "duration", result.Duration, "error", result.Err)
+		}
+		if attempt >= s.config.Retries || !result.retryable() {
+			return result, nil
+		}
+
+		// Give other connections time to release what ran out, or the proxy
+		// time to come back
+		if (result.Status == StatusError || result.Status == StatusProxyError) && !sleepContext(ctx, doubled(localBackoff, attempt)) {
+			return result, ctx.Err()
+		}
+
+		// A retry is another connection as far as delay and rate go
+		if !s.pace(ctx) {
+			return result, ctx.Err()
+		}
+	}
+}
+
+// hostRTT returns the estimator for the timeouts of a target of an
+// interleaved sweep, creating it on first use, or nil when timeouts are fixed
+func (s *Scanner) hostRTT(host string) *rttEstimator {
+	if !s.config.AdaptiveTimeout {
+		return nil
 	}
+	e, ok := s.rtts[host]
+	if !ok {
+		e = s.newRTTEstimator()
+		s.rtts[host] = e
+	}
+	return e
+}
+
+// newRTTEstimator returns the estimator for the timeouts of one target, or
+// nil when timeouts are fixed
+func (s *Scanner) newRTTEstimator() *rttEstimator {
+	if !s.config.AdaptiveTimeout {
+		return nil
+	}
+	return newRTTEstimator(s.config.Timeout, s.config.MinTimeout, s.config.MaxTimeout)
+}
+
+// probeOptions derives the per-port probe options for a target from the
+// scan configuration
+func (s *Scanner) probeOptions(target network.Target) ProbeOptions {
+	return ProbeOptions{
+		Hostname:        target.Hostname,
+		Timeout:         s.config.Timeout,
+		DisableBanner:   s.config.DisableBanner,
+		DetectTLS:       s.config.DetectTLS,
+		Probes:          s.config.Probes,
+		FollowRedirects: s.config.FollowRedirects,
+		Proxy:           s.config.Proxy,
+		Source:          s.config.Source,
+		Dialer:          s.config.Dialer,
+	}
+}
 
-	return results
+// pace waits before a port scan for the configured delay (between scans, not
+// while idle) and for the rate limiter. It returns false if ctx was cancelled.
+func (s *Scanner) pace(ctx context.Context) bool {
+	if s.config.DelayBetween > 0 && !sleepContext(ctx, s.config.DelayBetween) {
+		return false
+	}
+	return s.limiter == nil || s.limiter.wait(ctx)
+}
+
+// sleepContext sleeps for d and reports whether it did so without ctx being cancelled
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 // updateStats updates scan statistics thread-safely
@@ -123,46 +446,68 @@ func (s *Scanner) updateStats(result ScanResult) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.stats.add(result)
+}
+
+// finish records how long the scan took, the rate it achieved and the
+// latency figures
+func (st *ScanStatistics) finish(duration time.Duration) {
+	st.ScanDuration = duration
+	if duration > 0 {
+		st.Rate = float64(st.TotalPorts-st.resumed) / duration.Seconds()
+	}
+	if h := st.latencies; h != nil {
+		st.MinLatency, st.MaxLatency = h.min, h.max
+		st.AvgLatency = h.sum / time.Duration(h.count)
+		st.P95Latency = h.percentile(0.95)
+	}
+}
+
+// add counts a result in the statistics
+func (st *ScanStatistics) add(result ScanResult) {
+	st.TotalPorts++
 	switch result.Status {
 	case StatusOpen:
-		s.stats.OpenPorts++
+		st.OpenPorts++
 	case StatusClosed:
-		s.stats.ClosedPorts++
+		st.ClosedPorts++
 	case StatusFiltered:
-		s.stats.FilteredPorts++
+		st.FilteredPorts++
+	case StatusOpenFiltered:
+		st.OpenFilteredPorts++
+	case StatusError:
+		st.ErrorPorts++
+	case StatusProxyError:
+		st.ProxyErrorPorts++
 	}
-}
-
-// shufflePorts randomizes the order of ports
-func (s *Scanner) shufflePorts(ports []int) {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	r.Shuffle(len(ports), func(i, j int) {
-		ports[i], ports[j] = ports[j], ports[i]
-	})
-}
-
-// customShufflePorts randomizes the order of ports using Fisher-Yates algorithm
-// This is a completely custom implementation without using any external packages
-// It implements its own Linear Congruential Generator (LCG) for random numbers
-func (s *Scanner) customShufflePorts(ports []int) {
-	fmt.Println("Shuffling ports using custom algorithm")
-	n := len(ports)
-	if n <= 1 {
-		return
+	if result.Latency > 0 {
+		if st.latencies == nil {
+			st.latencies = &latencyHistogram{}
+		}
+		st.latencies.add(result.Latency)
 	}
+}
 
-	// Initialize seed from current time
-	seed := time.Now().UnixNano()
+// shuffledIndexes yields 0..n-1 in a random order without storing them. It
+// walks the full cycle of a Linear Congruential Generator modulo the next
+// power of two and skips values past n. With c odd and a-1 divisible by 4
+// the generator visits every value exactly once (Hull-Dobell theorem).
+func shuffledIndexes(n int, seed int64) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		m := 1
+		for m < n {
+			m <<= 1
+		}
+		mask := m - 1
 
-	// Fisher-Yates shuffle algorithm with custom random number generator
-	for i := n - 1; i > 0; i-- {
-		// Generate a random index between 0 and i (inclusive)
-		// Using Linear Congruential Generator (LCG): next = (a * seed + c) mod m
-		seed = (seed*1103515245 + 12345) & 0x7fffffff // LCG algorithm
-		// fmt.Println("seed: ",seed)
-		j := int(seed) % (i + 1)
-		// fmt.Println("j",j)
-		// fmt.Println("i",i)
-		ports[i], ports[j] = ports[j], ports[i]
+		// The seed picks both the starting point and the increment
+		x := int(seed) & mask
+		c := int(uint64(seed)>>17)&mask | 1
+		for i := 0; i < m; i++ {
+			x = (x*1103515245 + c) & mask // LCG algorithm
+			if x < n && !yield(x) {
+				return
+			}
+		}
 	}
 }
@@ -0,0 +1,81 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"metron_code_jam/internal/network"
+	"metron_code_jam/pkg/metronet/fakenet"
+)
+
+func TestInterleavedTimeoutsPerHost(t *testing.T) {
+	n := fakenet.New()
+	n.Set("tcp", "10.0.0.1:22", fakenet.Port{State: fakenet.Open, Delay: 5 * time.Millisecond})
+	n.Set("tcp", "10.0.0.2:22", fakenet.Port{State: fakenet.Open, Delay: 300 * time.Millisecond})
+	targets, err := network.ParseTargets(context.Background(), []string{"10.0.0.1-2"}, network.TargetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewScanner(ScanConfig{
+		Targets:         targets,
+		Ports:           network.NewPortSet(network.PortRange{First: 22, Last: 22}),
+		Timeout:         time.Second,
+		AdaptiveTimeout: true,
+		Interleave:      true,
+		DisableBanner:   true,
+		Dialer:          n,
+	})
+	if _, _, err := s.ScanContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	fast, slow := s.hostRTT("10.0.0.1"), s.hostRTT("10.0.0.2")
+	if fast == slow {
+		t.Fatal("both hosts share one estimator")
+	}
+	if fast.timeout(0) >= slow.timeout(0) {
+		t.Errorf("fast host waits %v, slow host %v", fast.timeout(0), slow.timeout(0))
+	}
+}
+
+func TestFixedTimeoutDoublesOnRetry(t *testing.T) {
+	n := fakenet.New()
+	n.Set("tcp", "10.0.0.1:22", fakenet.Port{State: fakenet.Open, Delay: 150 * time.Millisecond})
+
+	tests := []struct {
+		timeout time.Duration
+		retries int
+		status  PortStatus
+	}{
+		{100 * time.Millisecond, 0, StatusFiltered},
+		// The second attempt waits 200ms, long enough
+		{100 * time.Millisecond, 1, StatusOpen},
+		// The timeout stops growing at 8 times 15ms, 120ms; uncapped, the
+		// fifth attempt would wait 240ms
+		{15 * time.Millisecond, 4, StatusFiltered},
+	}
+	for _, tt := range tests {
+		s := NewScanner(ScanConfig{
+			Host:          "10.0.0.1",
+			Ports:         network.NewPortSet(network.PortRange{First: 22, Last: 22}),
+			Timeout:       tt.timeout,
+			Retries:       tt.retries,
+			DisableBanner: true,
+			Dialer:        n,
+		})
+		results, _, err := s.ScanContext(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Status != tt.status {
+			t.Errorf("%v timeout, %d retries: got %+v, want %s", tt.timeout, tt.retries, results, tt.status)
+		}
+	}
+
+	// Shifting by the attempt number must not overflow
+	if got := doubled(time.Second, 100); got != 8*time.Second {
+		t.Errorf("timeout after 100 attempts = %v, want 8s", got)
+	}
+}
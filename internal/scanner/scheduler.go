@@ -0,0 +1,222 @@
+package scanner
+
+import (
+	"context"
+	"iter"
+	"sort"
+	"sync"
+	"time"
+
+	"metron_code_jam/internal/network"
+)
+
+// HostResult holds the outcome of scanning one target
+type HostResult struct {
+	Target  network.Target
+	Results []ScanResult // sorted by port; nil when ScanConfig.DiscardResults is set
+	Stats   ScanStatistics
+}
+
+// hostScan tracks a target while the scheduler works on it
+type hostScan struct {
+	target   network.Target
+	next     func() (protoPort, bool) // pulls the next port to scan
+	stop     func()
+	pending  bool // ports remain to be handed out
+	inFlight int
+	rtt      *rttEstimator
+	started  time.Time
+	results  []ScanResult
+	stats    ScanStatistics
+}
+
+// hostJob is one port of an active target
+type hostJob struct {
+	host *hostScan
+	port protoPort
+}
+
+// outcome is what a worker reports back for a job. err is set when the scan
+// was interrupted before the port state was known.
+type outcome struct {
+	host   *hostScan
+	result ScanResult
+	err    error
+}
+
+// schedule scans the ports of many targets with one pool of MaxConcurrency
+// workers. Up to ParallelHosts targets are active at a time and workers take
+// ports from them in turn, never more than MaxPerHost at once from the same
+// target, so a slow host only holds up its own share of the workers. Each
+// target is reported to OnHostDone as soon as its last port is scanned.
+func (s *Scanner) schedule(ctx context.Context) []ScanResult {
+	var all []ScanResult
+	jobs := make(chan hostJob)
+	outcomes := make(chan outcome)
+	var wg sync.WaitGroup
+
+	for i := 0; i < s.config.MaxConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				// Keep to the configured delay and rate
+				if !s.pace(ctx) {
+					outcomes <- outcome{host: j.host, err: ctx.Err()}
+					continue
+				}
+				result, err := s.scanPort(ctx, job{j.host.target, j.port, j.host.rtt})
+				outcomes <- outcome{host: j.host, result: result, err: err}
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	nextTarget, stopTargets := iter.Pull(s.targets())
+	defer stopTargets()
+	targetsLeft := true
+
+	ticks, stopTicks := s.progressTicks()
+	defer stopTicks()
+
+	var (
+		active []*hostScan
+		ready  *hostJob // picked but not yet taken by a worker
+		turn   int
+		done   = ctx.Done()
+	)
+	for {
+		// On cancellation hand out nothing more and let running ports finish
+		if ctx.Err() != nil && done != nil {
+			done, ready, targetsLeft = nil, nil, false
+			for _, h := range active {
+				h.pending = false
+			}
+		}
+
+		// Keep the window of active targets full
+		for targetsLeft && len(active) < s.config.ParallelHosts {
+			target, ok := nextTarget()
+			if !ok {
+				targetsLeft = false
+				break
+			}
+			next, stop := iter.Pull(s.portOrder())
+			h := &hostScan{
+				target:  target,
+				next:    next,
+				stop:    stop,
+				pending: true,
+				rtt:     s.newRTTEstimator(),
+				started: time.Now(),
+			}
+			s.seedHost(h)
+			active = append(active, h)
+		}
+
+		if ready == nil {
+			ready = s.nextJob(active, &turn)
+		}
+
+		// Report targets with nothing left to scan
+		remaining := active[:0]
+		for _, h := range active {
+			if h.pending || h.inFlight > 0 {
+				remaining = append(remaining, h)
+				continue
+			}
+			all = s.finishHost(h, all)
+		}
+		active = remaining
+		if len(active) == 0 {
+			if targetsLeft {
+				continue
+			}
+			return all
+		}
+
+		// A nil channel disables the send case when there is nothing to hand out
+		var (
+			send chan hostJob
+			next hostJob
+		)
+		if ready != nil {
+			send, next = jobs, *ready
+		}
+		select {
+		case send <- next:
+			ready.host.inFlight++
+			ready = nil
+		case o := <-outcomes:
+			o.host.inFlight--
+			if o.err != nil {
+				continue
+			}
+			o.host.stats.add(o.result)
+			s.updateStats(o.result)
+			if s.config.OnResult != nil {
+				s.config.OnResult(o.result)
+			}
+			if !s.config.DiscardResults {
+				o.host.results = append(o.host.results, o.result)
+			}
+		case <-ticks:
+			s.reportProgress(hostProgress(active, s.portCount()))
+		case <-done:
+		}
+	}
+}
+
+// nextJob picks the next port to scan from the active targets in turn,
+// skipping targets at their MaxPerHost limit. It returns nil when no target
+// can take another job right now.
+func (s *Scanner) nextJob(active []*hostScan, turn *int) *hostJob {
+	for i := range active {
+		h := active[(*turn+i)%len(active)]
+		if !h.pending || (s.config.MaxPerHost > 0 && h.inFlight >= s.config.MaxPerHost) {
+			continue
+		}
+		// Ports scanned by an earlier run are passed over
+		port, ok := h.next()
+		for ok && s.completed.has(h.target.IP, port.port, port.proto) {
+			port, ok = h.next()
+		}
+		if !ok {
+			h.pending = false
+			continue
+		}
+		*turn = (*turn + i + 1) % len(active)
+		return &hostJob{host: h, port: port}
+	}
+	return nil
+}
+
+// finishHost reports a target whose ports are all scanned and returns all
+// with its results added
+func (s *Scanner) finishHost(h *hostScan, all []ScanResult) []ScanResult {
+	h.stop()
+	h.stats.finish(time.Since(h.started))
+	s.progress.hostsDone++
+	sort.Slice(h.results, func(i, j int) bool {
+		a, b := h.results[i], h.results[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Protocol < b.Protocol
+	})
+
+	s.config.Logger.Info("host done",
+		"host", h.target.IP,
+		"hostname", h.target.Hostname,
+		"ports", h.stats.TotalPorts,
+		"open", h.stats.OpenPorts,
+		"duration", h.stats.ScanDuration)
+
+	if s.config.OnHostDone != nil {
+		s.config.OnHostDone(HostResult{Target: h.target, Results: h.results, Stats: h.stats})
+	}
+	return append(all, h.results...)
+}
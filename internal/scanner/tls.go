@@ -0,0 +1,165 @@
+package scanner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"time"
+)
+
+// TLSPorts lists ports whose services expect a TLS handshake right after connecting
+var TLSPorts = map[int]bool{
+	443:  true, // HTTPS
+	465:  true, // SMTPS
+	636:  true, // LDAPS
+	853:  true, // DNS over TLS
+	989:  true, // FTPS data
+	990:  true, // FTPS
+	992:  true, // Telnet over TLS
+	993:  true, // IMAPS
+	994:  true, // IRC over TLS
+	995:  true, // POP3S
+	2376: true, // Docker over TLS
+	5061: true, // SIP over TLS
+	5986: true, // WinRM over HTTPS
+	6443: true, // Kubernetes API
+	8443: true, // HTTPS-Alt
+	8883: true, // MQTT over TLS
+	9443: true, // HTTPS-Alt
+}
+
+// TLSInfo describes a completed TLS handshake
+type TLSInfo struct {
+	Version      string
+	CipherSuite  string
+	ALPN         string // negotiated application protocol, empty if none
+	ServerName   string // SNI sent in the ClientHello, empty if none
+	Certificates []CertificateInfo
+}
+
+// CertificateInfo describes one certificate of the chain presented by the server
+type CertificateInfo struct {
+	Subject            string
+	Issuer             string
+	SANs               []string
+	SerialNumber       string
+	NotBefore          time.Time
+	NotAfter           time.Time
+	KeyType            string
+	SignatureAlgorithm string
+	SelfSigned         bool
+	SHA256             string // fingerprint of the DER encoding
+}
+
+// handshakeTLS performs a TLS client handshake over conn. Certificates are
+// recorded, not verified, since scanned services often use self-signed or
+// internal certificates.
+func handshakeTLS(ctx context.Context, conn net.Conn, serverName string, timeout time.Duration) (*tls.Conn, *TLSInfo, error) {
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"http/1.1"},
+		MinVersion:         tls.VersionTLS10,
+	})
+
+	hsCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(hsCtx); err != nil {
+		return nil, nil, err
+	}
+
+	state := tlsConn.ConnectionState()
+	info := &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+		ServerName:  serverName,
+	}
+	for _, cert := range state.PeerCertificates {
+		info.Certificates = append(info.Certificates, describeCertificate(cert))
+	}
+
+	return tlsConn, info, nil
+}
+
+// describeCertificate extracts the fields of interest from a certificate
+func describeCertificate(cert *x509.Certificate) CertificateInfo {
+	info := CertificateInfo{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		SerialNumber:       cert.SerialNumber.Text(16),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		KeyType:            publicKeyType(cert),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		SelfSigned:         isSelfSigned(cert),
+	}
+
+	info.SANs = append(info.SANs, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	info.SANs = append(info.SANs, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		info.SANs = append(info.SANs, uri.String())
+	}
+
+	sum := sha256.Sum256(cert.Raw)
+	info.SHA256 = hex.EncodeToString(sum[:])
+
+	return info
+}
+
+// publicKeyType describes the algorithm and size of a certificate's public key
+func publicKeyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA-%s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return cert.PublicKeyAlgorithm.String()
+	}
+}
+
+// isSelfSigned reports whether a certificate is signed by its own key. The
+// signature is checked directly because CheckSignatureFrom rejects parents
+// without the CA flag, which many self-signed leaf certificates lack.
+func isSelfSigned(cert *x509.Certificate) bool {
+	if cert.Subject.String() != cert.Issuer.String() {
+		return false
+	}
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// dialTLS opens a new connection to address and performs a TLS handshake
+func dialTLS(ctx context.Context, opts ProbeOptions, address, name string) (net.Conn, *TLSInfo, error) {
+	conn, err := opts.dial(ctx, "tcp", address, opts.Timeout, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConn, info, err := handshakeTLS(ctx, conn, serverNameFor(name), opts.Timeout)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return tlsConn, info, nil
+}
+
+// serverNameFor returns the SNI to send for host, which is empty for IP literals
+func serverNameFor(host string) string {
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	return host
+}
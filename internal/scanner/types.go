@@ -1,6 +1,13 @@
 package scanner
 
-import "time"
+import (
+	"log/slog"
+	"time"
+
+	"metron_code_jam/internal/network"
+	"metron_code_jam/internal/probes"
+	"metron_code_jam/internal/proxy"
+)
 
 // PortStatus represents the status of a scanned port
 type PortStatus string
@@ -9,33 +16,185 @@ const (
 	StatusOpen     PortStatus = "OPEN"
 	StatusClosed   PortStatus = "CLOSED"
 	StatusFiltered PortStatus = "FILTERED"
+	// StatusOpenFiltered is reported for UDP ports that neither replied nor
+	// returned an ICMP port-unreachable
+	StatusOpenFiltered PortStatus = "OPEN|FILTERED"
+	// StatusError is reported when a local failure, such as running out of
+	// file descriptors, kept the scanner from learning the port's state
+	StatusError PortStatus = "ERROR"
+	// StatusProxyError is reported when a proxy failed, so the target was
+	// never asked about the port
+	StatusProxyError PortStatus = "PROXY-ERROR"
+)
+
+// Protocol is the transport protocol used to probe a port
+type Protocol string
+
+const (
+	ProtocolTCP Protocol = "tcp"
+	ProtocolUDP Protocol = "udp"
 )
 
 // ScanResult represents the result of scanning a single port
 type ScanResult struct {
-	Host    string
-	Port    int
-	Status  PortStatus
-	Service string
-	Banner  string
-	Body    string
+	Host     string
+	Hostname string // name Host was resolved from, if any
+	Port     int
+	Protocol Protocol
+	Status   PortStatus
+	Reason   Reason // what the status is based on
+	Err      error  // error behind Reason, if any
+	Service  string
+	Banner   string
+	Body     string
+	TLS      *TLSInfo  // set when a TLS handshake succeeded on the port
+	HTTP     *HTTPInfo // set when the port answered like a web server
+
+	// Timing of the probe. Latency is the connect time, or the round trip of
+	// a UDP reply, and is zero when the port never answered. FirstByte is
+	// the time from sending the probe that drew the banner to its first
+	// byte, so the wait on probes that got no answer is left out; it is
+	// zero when no banner was read.
+	StartedAt time.Time
+	Latency   time.Duration
+	FirstByte time.Duration
+	Duration  time.Duration // total time spent on the port
+
+	// Version details captured by the probe that identified the service
+	Product   string
+	Version   string
+	ExtraInfo string
+	OS        string   // operating system hinted at by the service
+	CPE       []string // CPE 2.3 formatted strings
 }
 
 // ScanConfig holds configuration for the scanner
 type ScanConfig struct {
-	Host           string
-	Ports          []int
-	Timeout        time.Duration
-	MaxConcurrency int
-	RandomizeOrder bool
-	DelayBetween   time.Duration
+	Host     string
+	Hostname string // name Host was resolved from; sent as SNI and HTTP Host
+	Ports    network.PortSet
+	Protocol Protocol // protocol of Ports; ProtocolTCP when empty
+	// UDPPorts are scanned over UDP as well as Ports, for scans that mix
+	// TCP and UDP
+	UDPPorts network.PortSet
+	Timeout  time.Duration
+	// AdaptiveTimeout derives connect timeouts from the round-trip times
+	// measured on each host, within [MinTimeout, MaxTimeout]. Timeout is
+	// then only used until the first measurement and for service probes.
+	AdaptiveTimeout bool
+	MinTimeout      time.Duration // 100ms when zero
+	MaxTimeout      time.Duration // Timeout when zero
+	Retries         int           // extra attempts for ports that timed out or failed for lack of local resources
+	MaxConcurrency  int
+	RandomizeOrder  bool
+	DelayBetween    time.Duration
+	Rate            float64        // port scans started per second across all workers; unlimited when zero
+	Burst           int            // scans that may start at once after an idle period; Rate/10, at least 1, when zero
+	DisableBanner   bool           // only check reachability, never read from open ports
+	DetectTLS       bool           // also try TLS on open ports that answered no plaintext probe, not just TLSPorts
+	Probes          *probes.Engine // service probes; DefaultProbes() when nil
+	FollowRedirects int            // redirects to follow on web servers, within the same host
+	// Proxy, if set, carries every TCP connection, for the port check and
+	// the banner grab alike. UDP ports cannot be scanned through it.
+	Proxy *proxy.Chain
+	// Source sets the local address, port and interface of every probe. A
+	// source port cannot be combined with Proxy, and outside Linux it
+	// needs MaxConcurrency 1, as only one socket at a time may hold it.
+	Source Source
+	// Dialer, if set, opens every connection in place of a net.Dialer, and
+	// the connection to the first proxy when there is one. Source cannot be
+	// combined with it.
+	Dialer Dialer
+
+	// Targets, if set, replaces Host: every port of every target is
+	// scanned by the same worker pool
+	Targets *network.TargetSet
+	// ParallelHosts is how many targets are scanned at the same time; 32,
+	// or enough to use all workers under MaxPerHost, when zero
+	ParallelHosts int
+	// MaxPerHost caps the ports of one target scanned at the same time; no
+	// cap when zero
+	MaxPerHost int
+	// Interleave scans each port on all targets before moving to the next
+	// port, spreading the load across hosts. ParallelHosts, MaxPerHost and
+	// OnHostDone do not apply.
+	Interleave bool
+
+	// Completed holds the results of an earlier, interrupted run of the same
+	// scan. Their ports are not scanned again; the results are counted and
+	// returned with the new ones but not passed to OnResult.
+	Completed []ScanResult
+
+	// OnResult, if set, is called with each result as soon as its port has
+	// been scanned. Calls are never concurrent.
+	OnResult func(ScanResult)
+	// OnHostDone, if set, is called with the results and statistics of each
+	// target once all its ports have been scanned
+	OnHostDone func(HostResult)
+	// OnProgress, if set, is called every ProgressInterval (1s when zero)
+	// and once more at the end with a snapshot of the scan. Calls are never
+	// concurrent with each other or with OnResult and OnHostDone.
+	OnProgress       func(Progress)
+	ProgressInterval time.Duration
+	// DiscardResults leaves results to OnResult instead of returning them,
+	// so that sweeps of any size run in constant memory
+	DiscardResults bool
+
+	// Logger receives diagnostics: the scan and each host at Info, every
+	// port and retry at Debug. Nothing is logged when nil.
+	Logger *slog.Logger
+}
+
+// ProbeOptions controls how a single port is probed
+type ProbeOptions struct {
+	Hostname        string
+	Timeout         time.Duration
+	ConnectTimeout  time.Duration // for the connect or UDP reply; Timeout when zero
+	DisableBanner   bool
+	DetectTLS       bool
+	Probes          *probes.Engine
+	FollowRedirects int
+	Proxy           *proxy.Chain // TCP connections go through it when set
+	Source          Source       // where connections leave from
+	Dialer          Dialer       // opens connections instead of Source when set
+
+	rtt *rttEstimator // receives round-trip samples, if set
+}
+
+// connectTimeout returns how long to wait for a port to answer
+func (o ProbeOptions) connectTimeout() time.Duration {
+	if o.ConnectTimeout > 0 {
+		return o.ConnectTimeout
+	}
+	return o.Timeout
+}
+
+// targetName returns the name host was given as, for SNI and HTTP Host headers
+func (o ProbeOptions) targetName(host string) string {
+	if o.Hostname != "" {
+		return o.Hostname
+	}
+	return host
 }
 
 // ScanStatistics holds overall scan statistics
 type ScanStatistics struct {
-	TotalPorts    int
-	OpenPorts     int
-	ClosedPorts   int
-	FilteredPorts int
-	ScanDuration  time.Duration
+	TotalPorts        int
+	OpenPorts         int
+	ClosedPorts       int
+	FilteredPorts     int
+	OpenFilteredPorts int
+	ErrorPorts        int
+	ProxyErrorPorts   int
+	ScanDuration      time.Duration
+	Rate              float64 // ports scanned per second
+
+	// Latency of the ports that answered, open or closed; zero when none did
+	MinLatency time.Duration
+	AvgLatency time.Duration
+	P95Latency time.Duration
+	MaxLatency time.Duration
+	latencies  *latencyHistogram
+
+	resumed int // ports taken from ScanConfig.Completed, left out of Rate
 }
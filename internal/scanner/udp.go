@@ -0,0 +1,155 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"metron_code_jam/internal/probes"
+)
+
+// UDPServiceSignatures maps common UDP port numbers to service names. It is
+// only consulted when no probe identified the service.
+var UDPServiceSignatures = map[int]string{
+	53:    "domain",
+	67:    "dhcps",
+	69:    "tftp",
+	123:   "ntp",
+	137:   "netbios-ns",
+	161:   "snmp",
+	162:   "snmptrap",
+	500:   "isakmp",
+	514:   "syslog",
+	1434:  "ms-sql-m",
+	1900:  "upnp",
+	5353:  "mdns",
+	11211: "memcached",
+}
+
+// ScanUDPPort scans a single UDP port and returns the result
+func ScanUDPPort(ctx context.Context, host string, port int, opts ProbeOptions) ScanResult {
+	result, _ := scanUDPPort(ctx, host, port, opts)
+	return result
+}
+
+// scanUDPPort sends the probe registered for the port over a connected UDP
+// socket, since most UDP services ignore datagrams they cannot parse. A reply
+// means the port is open; an ICMP port-unreachable, which the kernel reports
+// as ECONNREFUSED on a connected socket, means it is closed. Silence cannot
+// tell a listening service apart from a firewall, so it is reported as
+// open|filtered. It returns ctx.Err() when the scan was interrupted.
+func scanUDPPort(ctx context.Context, host string, port int, opts ProbeOptions) (result ScanResult, err error) {
+	result = ScanResult{
+		Host:      host,
+		Hostname:  opts.Hostname,
+		Port:      port,
+		Protocol:  ProtocolUDP,
+		Status:    StatusOpenFiltered,
+		Service:   IdentifyUDPService(port),
+		StartedAt: time.Now(),
+	}
+	defer func() {
+		result.Duration = time.Since(result.StartedAt)
+	}()
+
+	engine := opts.Probes
+	if engine == nil {
+		engine = DefaultProbes()
+	}
+	probe := udpProbe(engine, port)
+	var payload []byte
+	if probe != nil {
+		payload = probe.Payload
+	}
+
+	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
+	conn, err := opts.dial(ctx, "udp", address, opts.Timeout, true)
+	if err != nil {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		result.Status, result.Reason = classifyError(err)
+		result.Err = err
+		return result, nil
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	conn.SetDeadline(start.Add(opts.connectTimeout()))
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if _, err := conn.Write(payload); err != nil {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		result.Status, result.Reason = classifyUDPError(err)
+		result.Err = err
+		return result, nil
+	}
+
+	reply := make([]byte, 1024)
+	n, err := conn.Read(reply)
+	if n > 0 || errors.Is(err, syscall.ECONNREFUSED) {
+		result.Latency = time.Since(start)
+		opts.rtt.sample(result.Latency)
+	}
+	switch {
+	case n > 0:
+		result.Status, result.Reason = StatusOpen, ReasonUDPResponse
+		result.FirstByte = result.Latency
+		if !opts.DisableBanner {
+			result.Banner = cleanBanner(string(reply[:n]))
+		}
+		if probe != nil {
+			if match := engine.Match(probe, reply[:n]); match != nil {
+				result.applyMatch(match)
+			}
+		}
+	case ctx.Err() != nil:
+		return result, ctx.Err()
+	default:
+		result.Status, result.Reason = classifyUDPError(err)
+		result.Err = err
+	}
+
+	return result, nil
+}
+
+// classifyUDPError maps the error of a UDP exchange to the status it implies.
+// On a connected socket the kernel reports an ICMP port-unreachable as
+// ECONNREFUSED, and silence is a timeout that leaves the port open|filtered.
+func classifyUDPError(err error) (PortStatus, Reason) {
+	status, reason := classifyError(err)
+	switch reason {
+	case ReasonRefused:
+		return StatusClosed, ReasonPortUnreach
+	case ReasonNoResponse:
+		return StatusOpenFiltered, ReasonNoResponse
+	}
+	return status, reason
+}
+
+// IdentifyUDPService returns the service name commonly found on a UDP port
+func IdentifyUDPService(port int) string {
+	if service, ok := UDPServiceSignatures[port]; ok {
+		return service
+	}
+	return "unknown"
+}
+
+// udpProbe returns the rarest-first probe registered for a UDP port, or nil
+// when the port has none and an empty datagram is sent instead
+func udpProbe(engine *probes.Engine, port int) *probes.Probe {
+	for _, p := range engine.ProbesFor(probes.UDP, port, false) {
+		if p.Ports.Contains(port) {
+			return p
+		}
+	}
+	return nil
+}
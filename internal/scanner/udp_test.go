@@ -0,0 +1,34 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScanUDPPort(t *testing.T) {
+	n := testNetwork(t)
+	opts := ProbeOptions{Timeout: 100 * time.Millisecond, Probes: testEngine(t), Dialer: n}
+
+	tests := []struct {
+		port   int
+		status PortStatus
+		reason Reason
+		banner string
+	}{
+		{53, StatusOpen, ReasonUDPResponse, "answer"},
+		{123, StatusOpenFiltered, ReasonNoResponse, ""},
+		{124, StatusOpenFiltered, ReasonNoResponse, ""},
+		{161, StatusClosed, ReasonPortUnreach, ""},
+	}
+	for _, tt := range tests {
+		result, err := scanUDPPort(context.Background(), "10.0.0.1", tt.port, opts)
+		if err != nil {
+			t.Errorf("port %d: %v", tt.port, err)
+			continue
+		}
+		if result.Status != tt.status || result.Reason != tt.reason || result.Banner != tt.banner {
+			t.Errorf("port %d = %s (%s) %q, want %s (%s) %q", tt.port, result.Status, result.Reason, result.Banner, tt.status, tt.reason, tt.banner)
+		}
+	}
+}
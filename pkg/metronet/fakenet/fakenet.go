@@ -0,0 +1,277 @@
+// Package fakenet is an in-memory network for running the scanner without
+// sockets. Ports are declared with the state they should appear in and the
+// banner and replies of the service behind them; dialing them then behaves
+// the way a real network would, timeouts and refused connections included.
+package fakenet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// State is how a simulated port answers
+type State int
+
+const (
+	Closed   State = iota // refuses connections; UDP probes get a port-unreachable
+	Open                  // accepts connections
+	Filtered              // never answers, so every dial or read times out
+)
+
+// Port describes a simulated port
+type Port struct {
+	State State
+	// Delay is how long the port takes to answer a connect, or a UDP
+	// probe, for slow hosts; callers that give up sooner time out
+	Delay time.Duration
+	// Banner is sent as soon as a TCP connection opens
+	Banner string
+	// Replies are tried in order against each chunk of data the client
+	// sends; the first that matches is answered. Data that matches none
+	// gets no answer.
+	Replies []Reply
+}
+
+// Reply is a scripted answer of a service
+type Reply struct {
+	Match []byte // prefix of the client's data; empty matches anything
+	Send  []byte
+	Close bool // hang up after sending, like an HTTP/1.0 server
+}
+
+// Network is an in-memory network. Ports that were not declared are in
+// the state set for their host, or closed. Create one with New.
+type Network struct {
+	mu    sync.Mutex
+	ports map[endpoint]Port
+	hosts map[string]State
+	dials map[endpoint]int
+}
+
+// endpoint is a port of a host, over "tcp" or "udp"
+type endpoint struct {
+	network string
+	address string
+}
+
+// New creates an empty network, where every port is closed
+func New() *Network {
+	return &Network{
+		ports: make(map[endpoint]Port),
+		hosts: make(map[string]State),
+		dials: make(map[endpoint]int),
+	}
+}
+
+// Set declares a port of a host, given as host:port, for "tcp" or "udp"
+func (n *Network) Set(network, address string, port Port) error {
+	key, err := newEndpoint(network, address)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.ports[key] = port
+	return nil
+}
+
+// SetHost sets the state of every port of host that was not declared with
+// Set, e.g. Filtered for a host behind a firewall that drops everything
+func (n *Network) SetHost(host string, state State) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.hosts[host] = state
+}
+
+// Dials returns how many times address was dialed over network
+func (n *Network) Dials(network, address string) int {
+	key, err := newEndpoint(network, address)
+	if err != nil {
+		return 0
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.dials[key]
+}
+
+// lookup returns the port behind key and counts the dial
+func (n *Network) lookup(key endpoint) Port {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.dials[key]++
+	if port, ok := n.ports[key]; ok {
+		return port
+	}
+	host, _, _ := net.SplitHostPort(key.address)
+	return Port{State: n.hosts[host]}
+}
+
+// DialContext connects to address. It waits for the port's Delay, and
+// for ever on filtered TCP ports, until ctx is done.
+func (n *Network) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	key, err := newEndpoint(network, address)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	port := n.lookup(key)
+	remote := addr(key)
+	fail := func(err error) error {
+		return &net.OpError{Op: "dial", Net: network, Addr: remote, Err: err}
+	}
+
+	// Datagram sockets connect without asking the host
+	delay := port.Delay
+	if key.network == "udp" {
+		delay = 0
+	}
+	if key.network == "tcp" && port.State == Filtered {
+		<-ctx.Done()
+		return nil, fail(contextError(ctx))
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, fail(contextError(ctx))
+		}
+	}
+	if key.network == "tcp" && port.State == Closed {
+		return nil, fail(os.NewSyscallError("connect", syscall.ECONNREFUSED))
+	}
+
+	client, server := net.Pipe()
+	local := addr{network: key.network, address: "127.0.0.1:0"}
+	go serve(server, port, key.network)
+	conn := &conn{Conn: client, local: local, remote: remote}
+	if key.network == "udp" && port.State == Closed {
+		return &refusedConn{conn}, nil
+	}
+	return conn, nil
+}
+
+// serve plays the service of port on the server end of a connection. Reads
+// and writes run apart so that neither side blocks the other, as socket
+// buffers would allow.
+func serve(server net.Conn, port Port, network string) {
+	replies := make(chan Reply)
+	go func() {
+		defer server.Close()
+		failed := false
+		if network == "tcp" && port.Banner != "" {
+			_, err := server.Write([]byte(port.Banner))
+			failed = err != nil
+		}
+		for reply := range replies {
+			if failed {
+				continue
+			}
+			if network == "udp" {
+				time.Sleep(port.Delay)
+			}
+			if _, err := server.Write(reply.Send); err != nil {
+				failed = true
+			}
+			if reply.Close {
+				server.Close()
+			}
+		}
+	}()
+
+	defer close(replies)
+	buf := make([]byte, 4096)
+	for {
+		n, err := server.Read(buf)
+		if err != nil {
+			return
+		}
+		// Filtered UDP ports swallow probes
+		if port.State != Open {
+			continue
+		}
+		for _, reply := range port.Replies {
+			if bytes.HasPrefix(buf[:n], reply.Match) {
+				replies <- reply
+				break
+			}
+		}
+	}
+}
+
+// contextError is the error of a dial cut short by ctx: a timeout when its
+// deadline passed
+func contextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return os.ErrDeadlineExceeded
+	}
+	return ctx.Err()
+}
+
+func newEndpoint(network, address string) (endpoint, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		network = "tcp"
+	case "udp", "udp4", "udp6":
+		network = "udp"
+	default:
+		return endpoint{}, fmt.Errorf("fakenet: unsupported network %s", network)
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return endpoint{}, err
+	}
+	return endpoint{network: network, address: net.JoinHostPort(host, port)}, nil
+}
+
+// addr is the net.Addr of an endpoint
+type addr endpoint
+
+func (a addr) Network() string { return a.network }
+func (a addr) String() string  { return a.address }
+
+// conn is the client end of a connection, with the addresses of the
+// simulated endpoints rather than those of the pipe
+type conn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.local }
+func (c *conn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	return n, c.opError(err)
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	return n, c.opError(err)
+}
+
+// opError names the simulated endpoints in the errors of the pipe
+func (c *conn) opError(err error) error {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return err
+	}
+	return &net.OpError{Op: opErr.Op, Net: c.remote.Network(), Source: c.local, Addr: c.remote, Err: opErr.Err}
+}
+
+// refusedConn is a UDP socket to a closed port: reads fail the way the
+// kernel reports an ICMP port-unreachable
+type refusedConn struct {
+	*conn
+}
+
+func (c *refusedConn) Read(b []byte) (int, error) {
+	return 0, &net.OpError{Op: "read", Net: "udp", Addr: c.remote, Err: os.NewSyscallError("recvfrom", syscall.ECONNREFUSED)}
+}
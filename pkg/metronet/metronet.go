@@ -0,0 +1,59 @@
+// Package metronet scans TCP and UDP ports and identifies the services
+// behind them. It is the library the metronet command is built on:
+//
+//	targets, err := metronet.ParseTargets(ctx, []string{"10.0.0.0/24"}, metronet.TargetOptions{})
+//	...
+//	ports, err := metronet.ParsePorts("22,80,443,U:53")
+//	...
+//	results, stats, err := metronet.New(metronet.WithConcurrency(200)).Scan(ctx, targets, ports)
+//
+// The API follows semantic versioning: within a major Version, exported
+// names are only ever added, never removed or changed in meaning. Its types
+// are its own, so changes to the scanner's internals cannot leak into it.
+package metronet
+
+// Version is the semantic version of the API
+const Version = "1.0.0"
+
+// Status is the state a port was found in
+type Status string
+
+const (
+	StatusOpen         Status = "OPEN"
+	StatusClosed       Status = "CLOSED"
+	StatusFiltered     Status = "FILTERED"
+	StatusOpenFiltered Status = "OPEN|FILTERED" // UDP port that gave no answer either way
+	StatusError        Status = "ERROR"         // a local failure left the state unknown
+	StatusProxyError   Status = "PROXY-ERROR"   // a proxy failure left the state unknown
+)
+
+// Reason tells what a Status is based on
+type Reason string
+
+const (
+	ReasonSynAck       Reason = "syn-ack"      // the TCP handshake completed
+	ReasonUDPResponse  Reason = "udp-response" // the UDP probe got a reply
+	ReasonRefused      Reason = "conn-refused" // TCP reset in answer to the SYN
+	ReasonPortUnreach  Reason = "port-unreach" // ICMP port unreachable (UDP)
+	ReasonReset        Reason = "reset"        // the connection was reset while opening
+	ReasonNoResponse   Reason = "no-response"  // nothing came back before the timeout
+	ReasonHostUnreach  Reason = "host-unreach"
+	ReasonNetUnreach   Reason = "net-unreach"
+	ReasonFDExhausted  Reason = "fd-exhausted"  // no file descriptor left on this machine
+	ReasonNoResources  Reason = "no-resources"  // local buffers or ephemeral ports ran out
+	ReasonPermission   Reason = "permission"    // e.g. a local firewall rule
+	ReasonLocalFailure Reason = "local-failure" // any other local error
+	ReasonProxyUnreach Reason = "proxy-unreach" // the proxy could not be reached
+	ReasonProxyAuth    Reason = "proxy-auth"    // the proxy rejected the credentials
+	ReasonProxyDenied  Reason = "proxy-denied"  // the proxy's rules forbid the connection
+	ReasonProxyGateway Reason = "proxy-gateway" // an HTTP proxy answered 502 or 503
+	ReasonProxyFailure Reason = "proxy-failure" // any other error of the proxy
+)
+
+// Protocol is the transport protocol of a port
+type Protocol string
+
+const (
+	ProtocolTCP Protocol = "tcp"
+	ProtocolUDP Protocol = "udp"
+)
@@ -0,0 +1,121 @@
+package metronet_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"metron_code_jam/pkg/metronet"
+	"metron_code_jam/pkg/metronet/fakenet"
+)
+
+func TestScan(t *testing.T) {
+	n := fakenet.New()
+	n.Set("tcp", "10.0.0.1:22", fakenet.Port{State: fakenet.Open, Banner: "SSH-2.0-OpenSSH_9.6\r\n"})
+	n.Set("tcp", "10.0.0.1:81", fakenet.Port{State: fakenet.Filtered})
+	n.Set("udp", "10.0.0.1:53", fakenet.Port{State: fakenet.Open, Replies: []fakenet.Reply{{Send: []byte("answer")}}})
+
+	ctx := context.Background()
+	targets, err := metronet.ParseTargets(ctx, []string{"10.0.0.1"}, metronet.TargetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports, err := metronet.ParsePorts("22,80,81,U:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var done []metronet.HostResult
+	s := metronet.New(
+		metronet.WithDialer(n),
+		metronet.WithTimeout(200*time.Millisecond),
+		metronet.WithRetries(0),
+		metronet.OnHostDone(func(host metronet.HostResult) { done = append(done, host) }),
+	)
+	results, stats, err := s.Scan(ctx, targets, ports)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int]metronet.Status{
+		22: metronet.StatusOpen,
+		80: metronet.StatusClosed,
+		81: metronet.StatusFiltered,
+		53: metronet.StatusOpen,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for _, r := range results {
+		if r.Status != want[r.Port] {
+			t.Errorf("port %d/%s = %s, want %s", r.Port, r.Protocol, r.Status, want[r.Port])
+		}
+		if r.Port == 22 && (r.Service != "ssh" || r.Product != "OpenSSH" || r.Version != "9.6") {
+			t.Errorf("port 22 identified as %q %q %q", r.Service, r.Product, r.Version)
+		}
+	}
+	if stats.TotalPorts != 4 || stats.OpenPorts != 2 || stats.ClosedPorts != 1 || stats.FilteredPorts != 1 {
+		t.Errorf("statistics = %+v", stats)
+	}
+	if len(done) != 1 || done[0].Target.IP != "10.0.0.1" || len(done[0].Results) != 4 {
+		t.Errorf("OnHostDone got %+v", done)
+	}
+}
+
+func TestScanThroughFailingProxy(t *testing.T) {
+	// Nothing listens where the proxy should be
+	n := fakenet.New()
+	chain, err := metronet.ParseProxies([]string{"socks5://10.9.9.9:1080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := metronet.ParseTargets(context.Background(), []string{"10.0.0.1"}, metronet.TargetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := metronet.New(metronet.WithDialer(n), metronet.WithProxy(chain), metronet.WithRetries(0))
+	results, _, err := s.Scan(context.Background(), targets, metronet.PortList{TCP: metronet.NewPortSet(metronet.PortRange{First: 22, Last: 22})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	r := results[0]
+	var proxyErr *metronet.ProxyError
+	if r.Status != metronet.StatusProxyError || r.Reason != metronet.ReasonProxyUnreach || !errors.As(r.Err, &proxyErr) {
+		t.Errorf("got %s (%s) %v, want an unreachable proxy", r.Status, r.Reason, r.Err)
+	}
+}
+
+func TestScanWithoutTargets(t *testing.T) {
+	ports, err := metronet.ParsePorts("22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := metronet.New(metronet.WithDialer(fakenet.New()))
+	for _, targets := range []*metronet.Targets{nil, {}} {
+		if _, _, err := s.Scan(context.Background(), targets, ports); !errors.Is(err, metronet.ErrNoTargets) {
+			t.Errorf("Scan(%v) error = %v, want ErrNoTargets", targets, err)
+		}
+	}
+}
+
+func TestNamedPortSetsIsACopy(t *testing.T) {
+	sets := metronet.NamedPortSets()
+	sets["web"] = "1"
+	delete(sets, "mail")
+
+	list, err := metronet.ParsePorts("web,mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Untagged.Len() < 10 {
+		t.Errorf("changing the returned map changed the web set: %d ports", list.Untagged.Len())
+	}
+	if _, ok := metronet.NamedPortSets()["mail"]; !ok {
+		t.Error("deleting from the returned map removed the mail set")
+	}
+}
@@ -0,0 +1,56 @@
+package metronet
+
+import (
+	"io"
+
+	"metron_code_jam/internal/probes"
+)
+
+// Probes is a set of service probes in nmap-service-probes syntax. Extend
+// one with LoadFile and set its intensity before passing it to WithProbes.
+type Probes struct {
+	engine *probes.Engine
+}
+
+// DefaultIntensity is the probe rarity up to which probes are sent to ports
+// they are not registered for
+const DefaultIntensity = probes.DefaultIntensity
+
+// DefaultProbes returns a new set of the built-in probes
+func DefaultProbes() *Probes {
+	return &Probes{probes.Default()}
+}
+
+// NewProbes returns an empty set of probes
+func NewProbes() *Probes {
+	return &Probes{probes.New()}
+}
+
+// Load reads probe definitions and adds them to the set. Lines with syntax
+// errors abort loading; patterns that only fail to compile are skipped and
+// listed by Warnings. source names r in error messages.
+func (p *Probes) Load(r io.Reader, source string) error {
+	return p.engine.Load(r, source)
+}
+
+// LoadFile reads probe definitions from a file and adds them to the set
+func (p *Probes) LoadFile(path string) error {
+	return p.engine.LoadFile(path)
+}
+
+// Intensity returns the rarity (0-9) up to which probes are sent to ports
+// they are not registered for
+func (p *Probes) Intensity() int {
+	return p.engine.Intensity
+}
+
+// SetIntensity sets the rarity (0-9) up to which probes are sent to ports
+// they are not registered for
+func (p *Probes) SetIntensity(intensity int) {
+	p.engine.Intensity = intensity
+}
+
+// Warnings lists the definitions that were skipped while loading
+func (p *Probes) Warnings() []string {
+	return p.engine.Warnings
+}
@@ -0,0 +1,328 @@
+package metronet
+
+import (
+	"errors"
+	"time"
+
+	"metron_code_jam/internal/proxy"
+	"metron_code_jam/internal/scanner"
+)
+
+// Result is the outcome of scanning one port
+type Result struct {
+	Host     string
+	Hostname string // name Host was resolved from, if any
+	Port     int
+	Protocol Protocol
+	Status   Status
+	Reason   Reason // what the status is based on
+	Err      error  // error behind Reason, if any; a *ProxyError for proxy failures
+	Service  string
+	Banner   string
+	Body     string
+	TLS      *TLSInfo  // set when a TLS handshake succeeded on the port
+	HTTP     *HTTPInfo // set when the port answered like a web server
+
+	// Timing of the probe. Latency is the connect time, or the round trip of
+	// a UDP reply, and is zero when the port never answered. FirstByte is
+	// the time from sending the probe that drew the banner to its first
+	// byte, so the wait on probes that got no answer is left out; it is
+	// zero when no banner was read.
+	StartedAt time.Time
+	Latency   time.Duration
+	FirstByte time.Duration
+	Duration  time.Duration // total time spent on the port
+
+	// Version details captured by the probe that identified the service
+	Product   string
+	Version   string
+	ExtraInfo string
+	OS        string   // operating system hinted at by the service
+	CPE       []string // CPE 2.3 formatted strings
+}
+
+// TLSInfo describes the TLS session found on a port
+type TLSInfo struct {
+	Version      string
+	CipherSuite  string
+	ALPN         string // negotiated application protocol, empty if none
+	ServerName   string // SNI sent in the ClientHello, empty if none
+	Certificates []CertificateInfo
+}
+
+// CertificateInfo describes one certificate of the chain a server sent
+type CertificateInfo struct {
+	Subject            string
+	Issuer             string
+	SANs               []string
+	SerialNumber       string
+	NotBefore          time.Time
+	NotAfter           time.Time
+	KeyType            string
+	SignatureAlgorithm string
+	SelfSigned         bool
+	SHA256             string // fingerprint of the DER encoding
+}
+
+// HTTPInfo describes the answer of a web server
+type HTTPInfo struct {
+	StatusCode      int
+	Status          string // status line text, e.g. "200 OK"
+	Server          string
+	PoweredBy       string
+	Location        string // redirect target, if any
+	CookieNames     []string
+	SecurityHeaders map[string]string // security headers present in the response
+	Title           string
+	Redirects       []HTTPRedirect // chain followed within the same host, if enabled
+}
+
+// HTTPRedirect is one redirect followed from a web server
+type HTTPRedirect struct {
+	URL        string
+	StatusCode int
+	Title      string
+}
+
+// Statistics sums up the results of a host or a whole scan
+type Statistics struct {
+	TotalPorts        int
+	OpenPorts         int
+	ClosedPorts       int
+	FilteredPorts     int
+	OpenFilteredPorts int
+	ErrorPorts        int
+	ProxyErrorPorts   int
+	ScanDuration      time.Duration
+	Rate              float64 // ports scanned per second
+
+	// Latency of the ports that answered, open or closed; zero when none did
+	MinLatency time.Duration
+	AvgLatency time.Duration
+	P95Latency time.Duration
+	MaxLatency time.Duration
+}
+
+// HostResult holds the results and statistics of one target
+type HostResult struct {
+	Target  Target
+	Results []Result // sorted by port; nil when results are not kept
+	Stats   Statistics
+}
+
+// Progress is a snapshot of a running scan
+type Progress struct {
+	PortsDone  int // ports scanned on all targets so far
+	PortsTotal int // ports to scan on all targets; zero if too many to count
+	OpenPorts  int
+	HostsDone  int // targets finished; not counted in interleaved scans
+	HostsTotal int
+	// Hosts are the targets being scanned right now; empty for interleaved
+	// scans, which work on every target at once
+	Hosts   []HostProgress
+	Elapsed time.Duration
+	Rate    float64       // ports scanned per second since the last report
+	ETA     time.Duration // time left at the average rate of this run; zero when unknown
+}
+
+// Percent returns the share of ports scanned, from 0 to 100
+func (p Progress) Percent() float64 {
+	if p.PortsTotal == 0 {
+		return 0
+	}
+	return 100 * float64(p.PortsDone) / float64(p.PortsTotal)
+}
+
+// HostProgress is the progress of one target being scanned
+type HostProgress struct {
+	Target     Target
+	PortsDone  int
+	PortsTotal int
+	OpenPorts  int
+}
+
+// newResult converts a result of the scanner
+func newResult(r scanner.ScanResult) Result {
+	return Result{
+		Host:      r.Host,
+		Hostname:  r.Hostname,
+		Port:      r.Port,
+		Protocol:  Protocol(r.Protocol),
+		Status:    Status(r.Status),
+		Reason:    Reason(r.Reason),
+		Err:       newError(r.Err),
+		Service:   r.Service,
+		Banner:    r.Banner,
+		Body:      r.Body,
+		TLS:       newTLSInfo(r.TLS),
+		HTTP:      newHTTPInfo(r.HTTP),
+		StartedAt: r.StartedAt,
+		Latency:   r.Latency,
+		FirstByte: r.FirstByte,
+		Duration:  r.Duration,
+		Product:   r.Product,
+		Version:   r.Version,
+		ExtraInfo: r.ExtraInfo,
+		OS:        r.OS,
+		CPE:       r.CPE,
+	}
+}
+
+// newResults converts a list of results of the scanner
+func newResults(results []scanner.ScanResult) []Result {
+	if results == nil {
+		return nil
+	}
+	converted := make([]Result, len(results))
+	for i, r := range results {
+		converted[i] = newResult(r)
+	}
+	return converted
+}
+
+// newError replaces a proxy failure of the scanner by a ProxyError
+func newError(err error) error {
+	var proxyErr *proxy.Error
+	if !errors.As(err, &proxyErr) {
+		return err
+	}
+	return &ProxyError{Proxy: proxyErr.Proxy, Op: proxyErr.Op, Err: proxyErr.Err}
+}
+
+// scanResult converts a result back for the scanner, for WithCompleted
+func (r Result) scanResult() scanner.ScanResult {
+	result := scanner.ScanResult{
+		Host:      r.Host,
+		Hostname:  r.Hostname,
+		Port:      r.Port,
+		Protocol:  scanner.Protocol(r.Protocol),
+		Status:    scanner.PortStatus(r.Status),
+		Reason:    scanner.Reason(r.Reason),
+		Err:       r.Err,
+		Service:   r.Service,
+		Banner:    r.Banner,
+		Body:      r.Body,
+		StartedAt: r.StartedAt,
+		Latency:   r.Latency,
+		FirstByte: r.FirstByte,
+		Duration:  r.Duration,
+		Product:   r.Product,
+		Version:   r.Version,
+		ExtraInfo: r.ExtraInfo,
+		OS:        r.OS,
+		CPE:       r.CPE,
+	}
+	if r.TLS != nil {
+		info := scanner.TLSInfo{
+			Version:     r.TLS.Version,
+			CipherSuite: r.TLS.CipherSuite,
+			ALPN:        r.TLS.ALPN,
+			ServerName:  r.TLS.ServerName,
+		}
+		for _, cert := range r.TLS.Certificates {
+			info.Certificates = append(info.Certificates, scanner.CertificateInfo(cert))
+		}
+		result.TLS = &info
+	}
+	if r.HTTP != nil {
+		info := scanner.HTTPInfo{
+			StatusCode:      r.HTTP.StatusCode,
+			Status:          r.HTTP.Status,
+			Server:          r.HTTP.Server,
+			PoweredBy:       r.HTTP.PoweredBy,
+			Location:        r.HTTP.Location,
+			CookieNames:     r.HTTP.CookieNames,
+			SecurityHeaders: r.HTTP.SecurityHeaders,
+			Title:           r.HTTP.Title,
+		}
+		for _, redirect := range r.HTTP.Redirects {
+			info.Redirects = append(info.Redirects, scanner.HTTPRedirect(redirect))
+		}
+		result.HTTP = &info
+	}
+	return result
+}
+
+func newTLSInfo(info *scanner.TLSInfo) *TLSInfo {
+	if info == nil {
+		return nil
+	}
+	t := &TLSInfo{
+		Version:     info.Version,
+		CipherSuite: info.CipherSuite,
+		ALPN:        info.ALPN,
+		ServerName:  info.ServerName,
+	}
+	for _, cert := range info.Certificates {
+		t.Certificates = append(t.Certificates, CertificateInfo(cert))
+	}
+	return t
+}
+
+func newHTTPInfo(info *scanner.HTTPInfo) *HTTPInfo {
+	if info == nil {
+		return nil
+	}
+	h := &HTTPInfo{
+		StatusCode:      info.StatusCode,
+		Status:          info.Status,
+		Server:          info.Server,
+		PoweredBy:       info.PoweredBy,
+		Location:        info.Location,
+		CookieNames:     info.CookieNames,
+		SecurityHeaders: info.SecurityHeaders,
+		Title:           info.Title,
+	}
+	for _, redirect := range info.Redirects {
+		h.Redirects = append(h.Redirects, HTTPRedirect(redirect))
+	}
+	return h
+}
+
+func newStatistics(stats scanner.ScanStatistics) Statistics {
+	return Statistics{
+		TotalPorts:        stats.TotalPorts,
+		OpenPorts:         stats.OpenPorts,
+		ClosedPorts:       stats.ClosedPorts,
+		FilteredPorts:     stats.FilteredPorts,
+		OpenFilteredPorts: stats.OpenFilteredPorts,
+		ErrorPorts:        stats.ErrorPorts,
+		ProxyErrorPorts:   stats.ProxyErrorPorts,
+		ScanDuration:      stats.ScanDuration,
+		Rate:              stats.Rate,
+		MinLatency:        stats.MinLatency,
+		AvgLatency:        stats.AvgLatency,
+		P95Latency:        stats.P95Latency,
+		MaxLatency:        stats.MaxLatency,
+	}
+}
+
+func newHostResult(host scanner.HostResult) HostResult {
+	return HostResult{
+		Target:  newTarget(host.Target),
+		Results: newResults(host.Results),
+		Stats:   newStatistics(host.Stats),
+	}
+}
+
+func newProgress(p scanner.Progress) Progress {
+	progress := Progress{
+		PortsDone:  p.PortsDone,
+		PortsTotal: p.PortsTotal,
+		OpenPorts:  p.OpenPorts,
+		HostsDone:  p.HostsDone,
+		HostsTotal: p.HostsTotal,
+		Elapsed:    p.Elapsed,
+		Rate:       p.Rate,
+		ETA:        p.ETA,
+	}
+	for _, host := range p.Hosts {
+		progress.Hosts = append(progress.Hosts, HostProgress{
+			Target:     newTarget(host.Target),
+			PortsDone:  host.PortsDone,
+			PortsTotal: host.PortsTotal,
+			OpenPorts:  host.OpenPorts,
+		})
+	}
+	return progress
+}
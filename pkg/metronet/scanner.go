@@ -0,0 +1,232 @@
+package metronet
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"metron_code_jam/internal/network"
+	"metron_code_jam/internal/scanner"
+)
+
+// Scanner scans ports with a fixed set of options. It holds no state
+// between scans, so one Scanner may run several at the same time.
+type Scanner struct {
+	config scanner.ScanConfig
+}
+
+// ErrNoTargets is returned by Scan when there is no target to scan
+var ErrNoTargets = errors.New("metronet: no targets")
+
+// Option configures a Scanner
+type Option func(*Scanner)
+
+// New creates a scanner. Without options it waits up to 2s for each port,
+// adapting the wait to measured round-trip times, retries ports that timed
+// out once, runs 100 connections at a time and grabs banners.
+func New(opts ...Option) *Scanner {
+	s := &Scanner{config: scanner.ScanConfig{
+		Timeout:         2 * time.Second,
+		AdaptiveTimeout: true,
+		MinTimeout:      100 * time.Millisecond,
+		Retries:         1,
+		MaxConcurrency:  100,
+	}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Scan scans ports on every target and returns the results, host by host
+// and sorted by port unless the scan is interleaved. Ports without a T: or
+// U: prefix are scanned over TCP.
+// When ctx is cancelled the results collected so far are returned with
+// ctx.Err(). Scan returns ErrNoTargets when targets is nil or empty.
+func (s *Scanner) Scan(ctx context.Context, targets *Targets, ports PortList) ([]Result, Statistics, error) {
+	if targets.Len() == 0 {
+		return nil, Statistics{}, ErrNoTargets
+	}
+	config := s.config
+	config.Targets = targets.set
+
+	// Ports holds the TCP ports unless there are none
+	tcp := ports.TCP.Union(ports.Untagged)
+	config.Ports, config.UDPPorts, config.Protocol = tcp.set, ports.UDP.set, scanner.ProtocolTCP
+	if tcp.Len() == 0 {
+		config.Ports, config.UDPPorts, config.Protocol = ports.UDP.set, network.PortSet{}, scanner.ProtocolUDP
+	}
+	results, stats, err := scanner.NewScanner(config).ScanContext(ctx)
+	return newResults(results), newStatistics(stats), err
+}
+
+// WithTimeout sets how long to wait for a port to answer, and for the
+// responses of services
+func WithTimeout(d time.Duration) Option {
+	return func(s *Scanner) { s.config.Timeout = d }
+}
+
+// WithAdaptiveTimeout derives connect timeouts from the round-trip times
+// measured on each host when enabled, the default, and always waits the
+// full timeout otherwise
+func WithAdaptiveTimeout(enabled bool) Option {
+	return func(s *Scanner) { s.config.AdaptiveTimeout = enabled }
+}
+
+// WithTimeoutBounds keeps adaptive timeouts within [min, max]; a zero max
+// stands for the timeout
+func WithTimeoutBounds(min, max time.Duration) Option {
+	return func(s *Scanner) { s.config.MinTimeout, s.config.MaxTimeout = min, max }
+}
+
+// WithRetries sets the extra attempts for ports that timed out or failed for
+// lack of local resources
+func WithRetries(n int) Option {
+	return func(s *Scanner) { s.config.Retries = n }
+}
+
+// WithConcurrency sets how many ports are scanned at the same time
+func WithConcurrency(n int) Option {
+	return func(s *Scanner) { s.config.MaxConcurrency = n }
+}
+
+// WithParallelHosts sets how many targets are scanned at the same time
+func WithParallelHosts(n int) Option {
+	return func(s *Scanner) { s.config.ParallelHosts = n }
+}
+
+// WithMaxPerHost caps the ports of one target scanned at the same time
+func WithMaxPerHost(n int) Option {
+	return func(s *Scanner) { s.config.MaxPerHost = n }
+}
+
+// WithInterleave scans each port on all targets before moving to the next
+// port. Results are then only complete once the whole scan is.
+func WithInterleave(enabled bool) Option {
+	return func(s *Scanner) { s.config.Interleave = enabled }
+}
+
+// WithRandomOrder scans ports in a random order
+func WithRandomOrder(enabled bool) Option {
+	return func(s *Scanner) { s.config.RandomizeOrder = enabled }
+}
+
+// WithDelay pauses each worker for d between two ports
+func WithDelay(d time.Duration) Option {
+	return func(s *Scanner) { s.config.DelayBetween = d }
+}
+
+// WithRate caps the ports scanned per second across all workers, letting
+// burst of them start at once after an idle period; a zero burst stands for
+// rate/10
+func WithRate(rate float64, burst int) Option {
+	return func(s *Scanner) { s.config.Rate, s.config.Burst = rate, burst }
+}
+
+// WithBanners grabs banners and identifies services on open ports when
+// enabled, the default, and only checks reachability otherwise
+func WithBanners(enabled bool) Option {
+	return func(s *Scanner) { s.config.DisableBanner = !enabled }
+}
+
+// WithTLSDetection also tries a TLS handshake on open ports that answered
+// none of the plaintext probes, not just on the ports known to expect TLS.
+// Ports that did answer are never handshaked.
+func WithTLSDetection(enabled bool) Option {
+	return func(s *Scanner) { s.config.DetectTLS = enabled }
+}
+
+// WithProbes identifies services with p instead of the built-in probes
+func WithProbes(p *Probes) Option {
+	return func(s *Scanner) {
+		s.config.Probes = nil
+		if p != nil {
+			s.config.Probes = p.engine
+		}
+	}
+}
+
+// WithFollowRedirects follows up to n redirects of web servers, within the
+// same host
+func WithFollowRedirects(n int) Option {
+	return func(s *Scanner) { s.config.FollowRedirects = n }
+}
+
+// WithProxy sends every TCP connection through the chain. UDP ports cannot
+// be scanned through it.
+func WithProxy(chain *ProxyChain) Option {
+	return func(s *Scanner) {
+		s.config.Proxy = nil
+		if chain != nil {
+			s.config.Proxy = chain.chain
+		}
+	}
+}
+
+// WithSource sets where probes leave from
+func WithSource(source Source) Option {
+	return func(s *Scanner) { s.config.Source = source.scannerSource() }
+}
+
+// WithDialer opens every connection with d, e.g. an in-memory network in
+// tests. It cannot be combined with WithSource.
+func WithDialer(d Dialer) Option {
+	return func(s *Scanner) { s.config.Dialer = d }
+}
+
+// WithCompleted skips the ports of results from an earlier, interrupted
+// run of the same scan. They are counted and returned with the new results
+// but not passed to the result handler.
+func WithCompleted(results []Result) Option {
+	return func(s *Scanner) {
+		s.config.Completed = make([]scanner.ScanResult, len(results))
+		for i, r := range results {
+			s.config.Completed[i] = r.scanResult()
+		}
+	}
+}
+
+// OnResult calls f with each result as soon as its port has been scanned
+func OnResult(f func(Result)) Option {
+	return func(s *Scanner) {
+		s.config.OnResult = nil
+		if f != nil {
+			s.config.OnResult = func(r scanner.ScanResult) { f(newResult(r)) }
+		}
+	}
+}
+
+// OnHostDone calls f with the results and statistics of each target once
+// all its ports have been scanned. Interleaved scans never call it.
+func OnHostDone(f func(HostResult)) Option {
+	return func(s *Scanner) {
+		s.config.OnHostDone = nil
+		if f != nil {
+			s.config.OnHostDone = func(host scanner.HostResult) { f(newHostResult(host)) }
+		}
+	}
+}
+
+// OnProgress calls f every interval, 1s when zero, and once more at the end
+func OnProgress(f func(Progress), interval time.Duration) Option {
+	return func(s *Scanner) {
+		s.config.OnProgress = nil
+		if f != nil {
+			s.config.OnProgress = func(p scanner.Progress) { f(newProgress(p)) }
+		}
+		s.config.ProgressInterval = interval
+	}
+}
+
+// WithResults returns results from Scan when enabled, the default. Disabled,
+// results are only passed to the OnResult and OnHostDone handlers, so that
+// scans of any size run in constant memory.
+func WithResults(enabled bool) Option {
+	return func(s *Scanner) { s.config.DiscardResults = !enabled }
+}
+
+// WithLogger logs the scan and each host at Info, and every port at Debug
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Scanner) { s.config.Logger = logger }
+}
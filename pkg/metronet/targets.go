@@ -0,0 +1,217 @@
+package metronet
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"maps"
+	"net/netip"
+
+	"metron_code_jam/internal/network"
+)
+
+// Target is one address to scan, with the name it was resolved from
+type Target struct {
+	IP       string // address to connect to
+	Hostname string // name the address was resolved from; empty for IP targets
+}
+
+// String returns the target as shown to users, e.g. "example.com (93.184.215.14)"
+func (t Target) String() string {
+	if t.Hostname == "" {
+		return t.IP
+	}
+	return fmt.Sprintf("%s (%s)", t.Hostname, t.IP)
+}
+
+func newTarget(t network.Target) Target {
+	return Target{IP: t.IP, Hostname: t.Hostname}
+}
+
+// TargetOptions controls how target specifications are expanded
+type TargetOptions struct {
+	ResolveAll bool     // scan every address of a hostname, not just the first
+	Exclude    []string // specifications of hosts that must never be scanned
+	// Family limits targets to "ip4" or "ip6" addresses; both are allowed
+	// when empty
+	Family string
+	// DualStack scans the first IPv4 and the first IPv6 address of each
+	// hostname instead of only the first address
+	DualStack bool
+	// MaxIPv6 caps the addresses of an IPv6 prefix or range; a /112 when
+	// zero
+	MaxIPv6 int
+	// Resolved holds addresses to use for hostnames instead of looking them
+	// up, as returned by Targets.Resolved, so that a scan run again covers
+	// the same addresses even if DNS has changed since
+	Resolved map[string][]string
+}
+
+// Targets is a set of addresses to scan, generated on demand. A nil or
+// zero Targets is empty.
+type Targets struct {
+	set *network.TargetSet
+}
+
+// All yields the targets in the order they were specified
+func (t *Targets) All() iter.Seq[Target] {
+	return func(yield func(Target) bool) {
+		if t == nil || t.set == nil {
+			return
+		}
+		for target := range t.set.All() {
+			if !yield(newTarget(target)) {
+				return
+			}
+		}
+	}
+}
+
+// Len returns the number of targets
+func (t *Targets) Len() int {
+	if t == nil || t.set == nil {
+		return 0
+	}
+	return t.set.Len()
+}
+
+// Resolved returns the addresses each hostname resolved to, to be passed as
+// TargetOptions.Resolved to expand the same specifications into the same
+// targets again
+func (t *Targets) Resolved() map[string][]string {
+	if t == nil || t.set == nil {
+		return nil
+	}
+	resolved := make(map[string][]string)
+	for name, addrs := range t.set.Resolved() {
+		for _, addr := range addrs {
+			resolved[name] = append(resolved[name], addr.String())
+		}
+	}
+	return resolved
+}
+
+// ParseTargets expands target specifications: IP addresses, hostnames, CIDR
+// subnets and ranges such as 10.0.0.1-40. Hostnames are resolved once, here,
+// unless they are in opts.Resolved.
+func ParseTargets(ctx context.Context, specs []string, opts TargetOptions) (*Targets, error) {
+	resolved := make(map[string][]netip.Addr, len(opts.Resolved))
+	for name, addrs := range opts.Resolved {
+		for _, s := range addrs {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q for %s: %v", s, name, err)
+			}
+			resolved[name] = append(resolved[name], addr.Unmap())
+		}
+	}
+	set, err := network.ParseTargets(ctx, specs, network.TargetOptions{
+		ResolveAll: opts.ResolveAll,
+		Exclude:    opts.Exclude,
+		Family:     opts.Family,
+		DualStack:  opts.DualStack,
+		MaxIPv6:    opts.MaxIPv6,
+		Resolved:   resolved,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Targets{set: set}, nil
+}
+
+// SplitTargets splits a comma- or space-separated list of specifications
+func SplitTargets(s string) []string {
+	return network.SplitTargets(s)
+}
+
+// ReadTargetFile reads specifications from a file, one or more per line;
+// # starts a comment
+func ReadTargetFile(path string) ([]string, error) {
+	return network.ReadTargetFile(path)
+}
+
+// PortRange is an inclusive range of ports
+type PortRange struct {
+	First, Last int
+}
+
+// PortSet is a set of ports, generated on demand. The zero value is empty.
+type PortSet struct {
+	set network.PortSet
+}
+
+// NewPortSet returns a set holding the given ranges, in order
+func NewPortSet(ranges ...PortRange) PortSet {
+	converted := make([]network.PortRange, len(ranges))
+	for i, r := range ranges {
+		converted[i] = network.PortRange{First: r.First, Last: r.Last}
+	}
+	return PortSet{network.NewPortSet(converted...)}
+}
+
+// Len returns the number of ports in the set
+func (p PortSet) Len() int {
+	return p.set.Len()
+}
+
+// At returns the i-th port of the set, counting from 0
+func (p PortSet) At(i int) int {
+	return p.set.At(i)
+}
+
+// All yields the ports of the set in order
+func (p PortSet) All() iter.Seq[int] {
+	return p.set.All()
+}
+
+// Without returns the ports of p that are not in exclude, in the same order
+func (p PortSet) Without(exclude PortSet) PortSet {
+	return PortSet{p.set.Without(exclude.set)}
+}
+
+// Union returns the ports in p or other, sorted and without duplicates
+func (p PortSet) Union(other PortSet) PortSet {
+	return PortSet{p.set.Union(other.set)}
+}
+
+// PortList splits ports by protocol, as given with T: and U: prefixes
+type PortList struct {
+	Untagged PortSet // entries before any prefix
+	TCP      PortSet
+	UDP      PortSet
+}
+
+// NamedPortSets returns the port sets that may be used by name in
+// ParsePorts, such as web or db, and their ports
+func NamedPortSets() map[string]string {
+	return maps.Clone(network.NamedPortSets)
+}
+
+// ParsePorts parses a port list such as "22,80-90,U:53,T:8000-", where
+// entries may also name a port set or a service. Service names are looked
+// up for the protocol of their T: or U: prefix, and as TCP services when
+// untagged.
+func ParsePorts(s string) (PortList, error) {
+	return ParsePortsFor(s, ProtocolTCP)
+}
+
+// ParsePortsFor is like ParsePorts, but looks untagged service names up for
+// untagged, the protocol the untagged ports will be scanned over
+func ParsePortsFor(s string, untagged Protocol) (PortList, error) {
+	list, err := network.ParsePortList(s, string(untagged))
+	if err != nil {
+		return PortList{}, err
+	}
+	return PortList{PortSet{list.Untagged}, PortSet{list.TCP}, PortSet{list.UDP}}, nil
+}
+
+// AllPorts returns every port, 1-65535
+func AllPorts() PortSet {
+	return PortSet{network.AllPorts()}
+}
+
+// TopPorts returns the n most common TCP ports, n being at most 1000
+func TopPorts(n int) (PortSet, error) {
+	set, err := network.TopPorts(n)
+	return PortSet{set}, err
+}